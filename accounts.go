@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+)
+
+// accountMapTTL is how long the account names read from Organizations are
+// cached.
+const accountMapTTL = 24 * time.Hour
+
+var accountIDPattern = regexp.MustCompile(`^\d{12}$`)
+
+type accountMap struct {
+	Updated  time.Time         `json:"updated"`
+	Accounts map[string]string `json:"accounts"`
+}
+
+func accountMapFile() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "accounts.json"), nil
+}
+
+// configuredAccounts returns the [accounts] section of the tool config, which
+// maps account names to IDs.
+func configuredAccounts() (map[string]string, error) {
+	name, err := toolConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	sections, err := readINIFile(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, s := range sections {
+		if s.Name == "accounts" {
+			return s.Values, nil
+		}
+	}
+	return nil, nil
+}
+
+func lookupAccount(accounts map[string]string, name string) (string, bool) {
+	for k, v := range accounts {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// resolveAccount returns the ID of the account called name, looking it up in
+// the tool config, the cached account map and finally AWS Organizations.
+// Account IDs are returned as is.
+func resolveAccount(ctx context.Context, cfg aws.Config, name string) (string, error) {
+	if accountIDPattern.MatchString(name) {
+		return name, nil
+	}
+	accounts, err := configuredAccounts()
+	if err != nil {
+		return "", err
+	}
+	if id, ok := lookupAccount(accounts, name); ok {
+		return id, nil
+	}
+
+	file, err := accountMapFile()
+	if err != nil {
+		return "", err
+	}
+	var cached accountMap
+	if b, err := os.ReadFile(file); err == nil {
+		json.Unmarshal(b, &cached)
+	}
+	if id, ok := lookupAccount(cached.Accounts, name); ok && time.Since(cached.Updated) < accountMapTTL {
+		return id, nil
+	}
+
+	m := accountMap{Updated: time.Now().UTC(), Accounts: map[string]string{}}
+	p := organizations.NewListAccountsPaginator(organizations.NewFromConfig(cfg), &organizations.ListAccountsInput{})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("account %q is not in the [accounts] section of the tool config and Organizations is not readable: %w", name, err)
+		}
+		for _, a := range out.Accounts {
+			m.Accounts[aws.ToString(a.Name)] = aws.ToString(a.Id)
+		}
+	}
+	if b, err := json.Marshal(m); err == nil {
+		writeFileAtomic(file, b)
+	}
+	if id, ok := lookupAccount(m.Accounts, name); ok {
+		return id, nil
+	}
+	return "", fmt.Errorf("account %q is not found in the organization", name)
+}
+
+// partition returns the partition of region.
+func partition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	}
+	return "aws"
+}
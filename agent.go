@@ -0,0 +1,548 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// agentMFADuration is the duration of the MFA session of the agent, from
+// which its role sessions are renewed without asking for codes.
+const agentMFADuration = 12 * time.Hour
+
+// serving is set in the agent, which must not ask itself for sessions.
+var serving bool
+
+// mfaSession replaces the source credentials and MFA of the calls to STS when
+// set, so the roles of a fan-out are assumed with one MFA code. The sessions
+// are still cached under the source credentials and the serial number.
+var mfaSession aws.CredentialsProvider
+
+// agentSocket returns the socket of the agent serving the requested session.
+// Requests are identical when they use the same parameters, except for
+// generated session names and MFA, which the agent handles itself.
+func agentSocket() (string, error) {
+	sessionName := roleSessionName
+	if generatedSessionName {
+		sessionName = ""
+	}
+	b, err := json.Marshal([]any{roleArns, roleArn, sessionName, roleSessionNames, externalIDs, duration, externalID, sourceIdentity, sessionTags, transitiveTagKeys, policyArns, policy})
+	if err != nil {
+		return "", err
+	}
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	// short enough for the socket path limits of macOS
+	return filepath.Join(dir, "agent", hex.EncodeToString(sum[:8])+".sock"), nil
+}
+
+// agentClient is an HTTP client connecting to the unix socket name.
+func agentClient(name string) *http.Client {
+	return &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", name)
+			},
+		},
+	}
+}
+
+// agentSession returns the session of a running agent for the requested
+// role, or nil when there is none.
+func agentSession(ctx context.Context) *sts.AssumeRoleOutput {
+	if serving {
+		return nil
+	}
+	name, err := agentSocket()
+	if err != nil {
+		return nil
+	}
+	if _, err := os.Stat(name); err != nil {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://agent/session", nil)
+	if err != nil {
+		return nil
+	}
+	resp, err := agentClient(name).Do(req)
+	if err != nil {
+		log.Printf("agent %s is not responding: %v", name, err)
+		return nil
+	}
+	defer resp.Body.Close()
+	var s cachedSession
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&s) != nil {
+		return nil
+	}
+	if s.Credentials == nil || s.Credentials.Expiration == nil || time.Until(*s.Credentials.Expiration) < time.Minute {
+		return nil
+	}
+	return &sts.AssumeRoleOutput{
+		Credentials:      s.Credentials,
+		AssumedRoleUser:  s.AssumedRoleUser,
+		SourceIdentity:   s.SourceIdentity,
+		PackedPolicySize: s.PackedPolicySize,
+	}
+}
+
+// agentServer serves the latest session of the role to invocations of the
+// tool through the unix socket, which only the user can access.
+type agentServer struct {
+	*credentialServer
+	role *sts.AssumeRoleOutput // guarded by mu
+}
+
+func (s *agentServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.serveHealth(w, r) {
+		return
+	}
+	if r.URL.Path != "/session" {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	creds, role := s.creds, s.role
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cachedSession{
+		Time:             time.Now(),
+		Credentials:      creds,
+		AssumedRoleUser:  role.AssumedRoleUser,
+		SourceIdentity:   role.SourceIdentity,
+		PackedPolicySize: role.PackedPolicySize,
+	})
+}
+
+// setRole replaces the session served by s.
+func (s *agentServer) setRole(role *sts.AssumeRoleOutput) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.creds, s.role = role.Credentials, role
+}
+
+// mfaSessionProvider returns the source credentials of the agent: an MFA
+// session of the source credentials, so MFA is asked when the agent starts
+// and then every agentMFADuration only.
+func mfaSessionProvider(ctx context.Context, loadOpts []func(*config.LoadOptions) error) (aws.CredentialsProvider, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, append([]func(*config.LoadOptions) error{config.WithHTTPClient(sharedHTTPClient())}, loadOpts...)...)
+	if err != nil {
+		return nil, err
+	}
+	client := sts.NewFromConfig(cfg, func(o *sts.Options) {
+		o.Retryer = aws.NopRetryer{}
+	})
+	serial := serialNumber
+	return aws.NewCredentialsCache(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		code := tokenCode
+		if code == "" || generatedTokenCode {
+			var err error
+			if code, err = mfaTokenCode(ctx); err != nil {
+				return aws.Credentials{}, err
+			}
+			tokenCode, generatedTokenCode = code, true
+		}
+		var out *sts.GetSessionTokenOutput
+		err := withRetry(ctx, "GetSessionToken", func(ctx context.Context) error {
+			var err error
+			out, err = client.GetSessionToken(ctx, &sts.GetSessionTokenInput{
+				DurationSeconds: aws.Int32(int32(agentMFADuration.Seconds())),
+				SerialNumber:    aws.String(serial),
+				TokenCode:       aws.String(code),
+			})
+			return err
+		})
+		if err != nil {
+			return aws.Credentials{}, err
+		}
+		c := out.Credentials
+		return aws.Credentials{
+			AccessKeyID:     *c.AccessKeyId,
+			SecretAccessKey: *c.SecretAccessKey,
+			SessionToken:    *c.SessionToken,
+			Source:          "GetSessionToken",
+			CanExpire:       true,
+			Expires:         *c.Expiration,
+		}, nil
+	})), nil
+}
+
+// agentMu serializes the resolution of the roles of the agent and their calls
+// to STS, which go through the flags of the role.
+var agentMu sync.Mutex
+
+// agentRole is a role held by the agent with the flags resolved for it,
+// served on the socket derived from them.
+type agentRole struct {
+	alias    string
+	entry    *catalogEntry
+	flags    catalogFlags
+	loadOpts []func(*config.LoadOptions) error
+	key      string // the socket derived from the flags
+	socket   string
+
+	server *agentServer
+	srv    *http.Server
+	stop   func()
+}
+
+// assume assumes the role with its flags.
+func (r *agentRole) assume(ctx context.Context) (*sts.AssumeRoleOutput, error) {
+	agentMu.Lock()
+	defer agentMu.Unlock()
+	r.flags.restore()
+	role, _, err := assumeRole(ctx, r.loadOpts)
+	return role, err
+}
+
+// agent holds the roles served by runServe.
+type agent struct {
+	base   catalogFlags // the flags before a catalog entry is applied
+	socket string       // -socket
+	mfa    map[[2]string]aws.CredentialsProvider
+	done   func() // stops the agent
+
+	mu    sync.Mutex
+	roles []*agentRole
+}
+
+// resolve resolves the flags of the catalog entry alias, or of the flags
+// alone without one. The sessions of roles with MFA are assumed from an MFA
+// session shared by the roles of the same source profile and device.
+func (a *agent) resolve(ctx context.Context, alias string) (*agentRole, error) {
+	r := &agentRole{alias: alias}
+	if alias != "" {
+		// resolveRole exits on invalid entries, which must not stop a
+		// running agent
+		c, err := loadCatalog()
+		if err != nil {
+			return nil, err
+		}
+		e, ok := c.lookup(alias)
+		if !ok {
+			return nil, fmt.Errorf("role %q is not found in the catalog", alias)
+		}
+		if e.RequireMFA && e.SerialNumber == "" && a.base.serialNumber == "" {
+			return nil, fmt.Errorf("role %s requires MFA but no serial number is configured", alias)
+		}
+		r.entry = e
+	}
+
+	agentMu.Lock()
+	defer agentMu.Unlock()
+	a.base.restore()
+	roleName = alias
+	r.loadOpts = resolveRole(ctx)
+	if serialNumber != "" && !sessionToken {
+		var profile string
+		if r.entry != nil {
+			profile = r.entry.SourceProfile
+		}
+		key := [2]string{profile, serialNumber}
+		if a.mfa[key] == nil {
+			p, err := mfaSessionProvider(ctx, r.loadOpts)
+			if err != nil {
+				return nil, err
+			}
+			a.mfa[key] = p
+		}
+		r.loadOpts = append(r.loadOpts, config.WithCredentialsProvider(a.mfa[key]))
+		serialNumber = ""
+	}
+	r.flags = currentCatalogFlags()
+	var err error
+	if r.key, err = agentSocket(); err != nil {
+		return nil, err
+	}
+	r.socket = a.socket
+	if r.socket == "" {
+		r.socket = r.key
+	}
+	return r, nil
+}
+
+// start serves the session role of r on its socket and renews it until r is
+// closed or ctx is done.
+func (a *agent) start(ctx context.Context, r *agentRole, role *sts.AssumeRoleOutput) error {
+	ln, closeSocket, err := listenAgent(r.socket)
+	if err != nil {
+		return err
+	}
+	r.server = &agentServer{credentialServer: &credentialServer{creds: role.Credentials}, role: role}
+	ctx, cancel := context.WithCancel(ctx)
+	go r.server.refreshLoop(ctx, func(ctx context.Context) (*types.Credentials, error) {
+		role, err := r.assume(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r.server.setRole(role)
+		return role.Credentials, nil
+	})
+	r.srv = &http.Server{Handler: r.server, ReadHeaderTimeout: 10 * time.Second}
+	r.stop = func() {
+		cancel()
+		r.srv.Close()
+		closeSocket()
+	}
+	go func() {
+		if err := r.srv.Serve(peerListener{ln}); !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("agent %s: %v", r.socket, err)
+		}
+	}()
+	log.Printf("serving %s on %s", r.flags.roleArn, r.socket)
+	return nil
+}
+
+// listenAgent listens on the unix socket name in a private directory, and
+// returns the function closing it and removing name, also run by the
+// cleanups.
+func listenAgent(name string) (net.Listener, func(), error) {
+	dir := filepath.Dir(name)
+	if err := mkdirPrivate(dir); err != nil {
+		return nil, nil, err
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0o077 != 0 {
+		return nil, nil, fmt.Errorf("%s is accessible by other users (%s), the socket serves credentials", dir, fi.Mode().Perm())
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, err
+	}
+	ln, err := net.Listen("unix", name)
+	if err != nil {
+		return nil, nil, err
+	}
+	closeSocket := atCleanup(func() {
+		ln.Close()
+		os.Remove(name)
+	})
+	if runtime.GOOS != "windows" {
+		if err := os.Chmod(name, 0o600); err != nil {
+			closeSocket()
+			return nil, nil, err
+		}
+	}
+	return ln, closeSocket, nil
+}
+
+// reload applies the changes of the catalog to the roles of the agent.
+// Unchanged roles keep their sessions, and so do the roles whose changes do
+// not affect the session, like its source profile. The other roles are
+// assumed again and moved to the socket of their new flags, or keep running
+// when their entry is invalid. Roles removed from the catalog are not served
+// anymore, and the agent stops without roles.
+func (a *agent) reload(ctx context.Context) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c, err := loadCatalog()
+	if err != nil {
+		log.Printf("cannot reload the catalog: %v", err)
+		return
+	}
+	a.roles = slices.DeleteFunc(a.roles, func(r *agentRole) bool {
+		if _, ok := c.lookup(r.alias); ok || r.alias == "" {
+			return false
+		}
+		log.Printf("%s is not in the catalog anymore, not serving it", r.alias)
+		r.stop()
+		return true
+	})
+	if len(a.roles) == 0 {
+		a.done()
+		return
+	}
+	for i, r := range a.roles {
+		if r.alias == "" {
+			continue
+		}
+		n, err := a.resolve(ctx, r.alias)
+		if err != nil {
+			log.Printf("cannot reload %s: %v", r.alias, err)
+			continue
+		}
+		if reflect.DeepEqual(n.entry, r.entry) {
+			continue
+		}
+		if n.key == r.key {
+			agentMu.Lock()
+			r.entry, r.flags, r.loadOpts = n.entry, n.flags, n.loadOpts
+			agentMu.Unlock()
+			log.Printf("reloaded %s", r.alias)
+			continue
+		}
+		role, err := n.assume(ctx)
+		if err != nil {
+			log.Printf("cannot reload %s: %v", r.alias, err)
+			continue
+		}
+		r.stop()
+		if err := a.start(ctx, n, role); err != nil {
+			log.Printf("cannot reload %s: %v", r.alias, err)
+			continue
+		}
+		a.roles[i] = n
+		log.Printf("reloaded %s", r.alias)
+	}
+}
+
+// watchCatalog calls reload on SIGHUP and when the tool config or the shared
+// AWS config changes, until ctx is done.
+func watchCatalog(ctx context.Context, reload func()) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	last := catalogStamp()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-ticker.C:
+			if stamp := catalogStamp(); stamp != last {
+				last = stamp
+			} else {
+				continue
+			}
+		}
+		reload()
+	}
+}
+
+// catalogStamp identifies the versions of the files of the catalog.
+func catalogStamp() string {
+	var stamp []string
+	for _, name := range []func() (string, error){toolConfigFile, awsConfigFile} {
+		file, err := name()
+		if err != nil {
+			continue
+		}
+		if fi, err := os.Stat(file); err == nil {
+			stamp = append(stamp, fmt.Sprint(fi.ModTime().UnixNano(), fi.Size()))
+		}
+	}
+	return strings.Join(stamp, " ")
+}
+
+// runServe keeps the sessions of the roles in memory, renewed before they
+// expire, and serves each of them to the invocations of the tool requesting
+// the same session until it is interrupted. The roles are the catalog entries
+// given as arguments, or the role of the flags. Catalog roles follow the
+// changes of the catalog, read again on SIGHUP and when the config files
+// change.
+func runServe(args []string) error {
+	socket := flag.String("socket", "", "unix socket to listen on, with a single role (default derived from the session in the cache directory)")
+	dropOnLock := flag.Bool("drop-on-lock", false, "exit and remove the cached sessions of the roles when the screen locks or the machine sleeps")
+	flag.CommandLine.Parse(args)
+	aliases := flag.Args()
+	if len(aliases) > 0 && (roleName != "" || roleArn != "") {
+		return errors.New("serve takes the roles either as catalog names or with the role flags")
+	}
+	if len(aliases) > 1 && *socket != "" {
+		return errors.New("-socket serves a single role")
+	}
+	serving = true
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	a := &agent{base: currentCatalogFlags(), socket: *socket, mfa: map[[2]string]aws.CredentialsProvider{}, done: cancel}
+	if len(aliases) == 0 {
+		alias := roleName
+		if alias == "" && roleArn == "" {
+			// -select and the default role resolve to an alias or an ARN
+			resolveRole(ctx)
+			if alias = roleName; alias == "" {
+				a.base.roleArn = roleArn
+			}
+		}
+		aliases = []string{alias}
+	}
+	// one after the other, since MFA may be asked for each
+	for _, alias := range aliases {
+		r, err := a.resolve(ctx, alias)
+		if err != nil {
+			return err
+		}
+		role, err := r.assume(ctx)
+		if err != nil {
+			return err
+		}
+		if err := a.start(ctx, r, role); err != nil {
+			return err
+		}
+		a.roles = append(a.roles, r)
+	}
+	go watchCatalog(ctx, func() { a.reload(ctx) })
+
+	if *dropOnLock {
+		go watchLock(ctx, func(reason string) {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			for _, r := range a.roles {
+				log.Printf("%s, dropping the sessions of %s", reason, r.flags.roleArn)
+				if err := dropCachedSessions(r.flags.roleArn); err != nil {
+					log.Printf("cannot remove the cached sessions: %v", err)
+				}
+			}
+			cancel()
+		})
+	}
+	<-ctx.Done()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, r := range a.roles {
+		r.stop()
+	}
+	return nil
+}
+
+// peerListener drops connections of other users to the agent.
+type peerListener struct {
+	net.Listener
+}
+
+func (l peerListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkPeer(c); err != nil {
+			log.Printf("agent: %v", err)
+			c.Close()
+			continue
+		}
+		return c, nil
+	}
+}
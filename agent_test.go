@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startServe runs serve with args on a socket of a temporary directory, and
+// returns once the socket exists. The agent is killed by the cleanups of t.
+func startServe(t *testing.T, env []string, args ...string) (*exec.Cmd, string) {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the socket path must be short
+	dir, err := os.MkdirTemp("", "aar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "s")
+	var sts string
+	for _, e := range env {
+		if v, ok := strings.CutPrefix(e, "AWS_ASSUME_ROLE_TEST_STS="); ok {
+			sts = v
+		}
+	}
+	cmd := exec.Command(exe, append([]string{"serve", "-endpoint-url", sts, "-rate-limit", "0", "-no-cache", "-socket", socket}, args...)...)
+	cmd.Env = env
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	for i := 0; ; i++ {
+		if _, err := os.Stat(socket); err == nil {
+			return cmd, socket
+		}
+		if i == 100 {
+			t.Fatal("serve did not create its socket")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// agentRoleArn returns the assumed role ARN of the session served on socket.
+func agentRoleArn(t *testing.T, socket string) string {
+	t.Helper()
+	resp, err := agentClient(socket).Get("http://agent/session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var s cachedSession
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&s) != nil || s.AssumedRoleUser == nil {
+		t.Fatalf("agent answered %s", resp.Status)
+	}
+	return *s.AssumedRoleUser.Arn
+}
+
+// TestServeReload changes the role of the catalog entry served by the agent
+// and checks that the agent serves the new role after SIGHUP.
+func TestServeReload(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals cannot be sent on windows")
+	}
+	srv := httptest.NewServer(&fakeSTS{})
+	defer srv.Close()
+
+	config := filepath.Join(t.TempDir(), "config")
+	writeRole := func(name string) {
+		b := []byte("[role dev]\nrole_arn = arn:aws:iam::123456789012:role/" + name + "\n")
+		if err := os.WriteFile(config, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeRole("First")
+	cmd, socket := startServe(t, append(toolEnv(t, srv), "AWS_ASSUME_ROLE_CONFIG="+config), "-role", "dev")
+	if arn := agentRoleArn(t, socket); !strings.Contains(arn, "/First/") {
+		t.Fatalf("agent serves %s before the reload", arn)
+	}
+
+	writeRole("Second")
+	cmd.Process.Signal(syscall.SIGHUP)
+	for i := 0; ; i++ {
+		// the socket moves back to the same path
+		if _, err := os.Stat(socket); err == nil {
+			if arn := agentRoleArn(t, socket); strings.Contains(arn, "/Second/") {
+				break
+			}
+		}
+		if i == 100 {
+			t.Fatal("agent did not reload the role")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// TestServeRoles serves two catalog roles from one agent, each on the socket
+// derived from its flags.
+func TestServeRoles(t *testing.T) {
+	sts := &fakeSTS{}
+	srv := httptest.NewServer(sts)
+	defer srv.Close()
+
+	config := filepath.Join(t.TempDir(), "config")
+	b := []byte("[role first]\nrole_arn = arn:aws:iam::123456789012:role/First\n[role second]\nrole_arn = arn:aws:iam::123456789012:role/Second\n")
+	if err := os.WriteFile(config, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	env := append(toolEnv(t, srv), "AWS_ASSUME_ROLE_CONFIG="+config)
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(exe, "serve", "-endpoint-url", srv.URL, "-rate-limit", "0", "-no-cache", "first", "second")
+	cmd.Env = env
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	sockets := map[string]string{}
+	sc := bufio.NewScanner(stderr)
+	for len(sockets) < 2 && sc.Scan() {
+		// serving arn:aws:iam::123456789012:role/First on /.../agent/0123456789abcdef.sock
+		if _, rest, ok := strings.Cut(sc.Text(), "serving "); ok {
+			arn, socket, _ := strings.Cut(rest, " on ")
+			sockets[arn[strings.LastIndex(arn, "/")+1:]] = socket
+		}
+	}
+	for name, socket := range sockets {
+		if arn := agentRoleArn(t, socket); !strings.Contains(arn, "/"+name+"/") {
+			t.Errorf("the socket of %s serves %s", name, arn)
+		}
+	}
+	if len(sockets) != 2 || sockets["First"] == sockets["Second"] {
+		t.Fatalf("agent serves on %v", sockets)
+	}
+
+	// invocations of the tool find the socket of their role
+	sts.mu.Lock()
+	calls := len(sts.signers)
+	sts.mu.Unlock()
+	out, err := exec.Command(exe, "-endpoint-url", srv.URL, "-rate-limit", "0", "-no-cache", "-role", "second", "-print-export").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "ASIASECOND") {
+		t.Errorf("-role second exports %s", out)
+	}
+	sts.mu.Lock()
+	defer sts.mu.Unlock()
+	if len(sts.signers) != calls {
+		t.Errorf("-role second called STS instead of the agent")
+	}
+}
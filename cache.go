@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// cachedSession is an AssumeRole result reused by later invocations requesting
+// the same session until it is about to expire, and shared with concurrent
+// ones within -share-window even with -no-cache.
+type cachedSession struct {
+	Time             time.Time
+	Credentials      *types.Credentials
+	AssumedRoleUser  *types.AssumedRoleUser
+	SourceIdentity   *string
+	PackedPolicySize *int32
+}
+
+// sessionCacheFile returns the cache file of the requested session.
+// Requests are identical when they use the same source identity and
+// parameters, except for generated session names and MFA token codes.
+func sessionCacheFile(ctx context.Context, cfg aws.Config) (string, error) {
+	source, err := cacheSource(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+	sessionName := roleSessionName
+	if generatedSessionName {
+		sessionName = ""
+	}
+	b, err := json.Marshal([]any{source, providerID, roleArns, roleArn, sessionName, roleSessionNames, externalIDs, duration, externalID, serialNumber, sourceIdentity, sessionTags, transitiveTagKeys, policyArns, policy})
+	if err != nil {
+		return "", err
+	}
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return filepath.Join(dir, "sessions", hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// cacheSource identifies the source credentials of cfg in the cache key.
+// Temporary credentials get other keys for every session, like the ones of
+// IAM Identity Center, of profiles assuming a role and of MFA sessions, so
+// they are identified by the portal role or by the identity of the caller.
+// Sessions of a role share the key whatever their session name, which is
+// usually generated.
+func cacheSource(ctx context.Context, cfg aws.Config) (string, error) {
+	switch {
+	case webIdentityTokenFile != "":
+		return webIdentitySource()
+	case ssoStartURL != "":
+		return "sso:" + ssoStartURL + "#" + ssoAccountID + "/" + ssoRoleName, nil
+	}
+	source, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return "", err
+	}
+	if source.SessionToken == "" {
+		return source.AccessKeyID, nil
+	}
+	id, err := callerIdentity(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+	c, err := newCaller(aws.ToString(id.Arn))
+	if err != nil {
+		return "", err
+	}
+	return c.principalArn(), nil
+}
+
+// loadCachedSession returns the cached session when it is still usable, and
+// removes it otherwise.
+func loadCachedSession(name string) *sts.AssumeRoleOutput {
+	b, err := readSessionCache(name)
+	if err != nil {
+		return nil
+	}
+	var r cachedSession
+	if err := json.Unmarshal(b, &r); err != nil || r.Credentials == nil || r.Credentials.Expiration == nil {
+		removeSessionCache(name)
+		return nil
+	}
+	valid := time.Until(*r.Credentials.Expiration) > cacheExpiryWindow
+	switch {
+	case !valid:
+		removeSessionCache(name)
+		return nil
+	case noCache && time.Since(r.Time) > shareWindow:
+		return nil
+	}
+	return &sts.AssumeRoleOutput{
+		Credentials:      r.Credentials,
+		AssumedRoleUser:  r.AssumedRoleUser,
+		SourceIdentity:   r.SourceIdentity,
+		PackedPolicySize: r.PackedPolicySize,
+	}
+}
+
+func storeCachedSession(name string, role *sts.AssumeRoleOutput) error {
+	b, err := json.Marshal(cachedSession{
+		Time:             time.Now(),
+		Credentials:      role.Credentials,
+		AssumedRoleUser:  role.AssumedRoleUser,
+		SourceIdentity:   role.SourceIdentity,
+		PackedPolicySize: role.PackedPolicySize,
+	})
+	if err != nil {
+		return err
+	}
+	if useKeyring() {
+		label := keyringService + " session"
+		if role.AssumedRoleUser != nil {
+			label += " " + aws.ToString(role.AssumedRoleUser.Arn)
+		}
+		return keyringSet(keyringSessionKey(name), label, b)
+	}
+	return writeFileAtomic(name, b)
+}
+
+// readSessionCache and removeSessionCache access the cache file name, or its
+// item in the OS keyring with -keyring.
+func readSessionCache(name string) ([]byte, error) {
+	if useKeyring() {
+		return keyringGet(keyringSessionKey(name))
+	}
+	return os.ReadFile(name)
+}
+
+func removeSessionCache(name string) {
+	if useKeyring() {
+		keyringDelete(keyringSessionKey(name))
+		return
+	}
+	os.Remove(name)
+}
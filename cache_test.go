@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+func TestSessionCacheFile(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	arn, name, generated, code, tags, provider := roleArn, roleSessionName, generatedSessionName, tokenCode, sessionTags, providerID
+	t.Cleanup(func() {
+		roleArn, roleSessionName, generatedSessionName, tokenCode, sessionTags, providerID = arn, name, generated, code, tags, provider
+	})
+
+	cfg := aws.Config{Credentials: credentials.NewStaticCredentialsProvider("AKIAEXAMPLE", "secret", "")}
+	key := func(t *testing.T, cfg aws.Config) string {
+		name, err := sessionCacheFile(context.Background(), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+	reset := func() {
+		roleArn = "arn:aws:iam::123456789012:role/Admin"
+		roleSessionName, generatedSessionName = "1700000000000000000", true
+		tokenCode, providerID = "", ""
+		sessionTags = []types.Tag{{Key: aws.String("Project"), Value: aws.String("x")}}
+	}
+	reset()
+	want := key(t, cfg)
+
+	tests := []struct {
+		name   string
+		change func()
+		same   bool
+	}{
+		{name: "identical", change: func() {}, same: true},
+		{name: "generated session name", change: func() { roleSessionName = "1800000000000000000" }, same: true},
+		{name: "token code", change: func() { tokenCode = "123456" }, same: true},
+		{name: "session name", change: func() { roleSessionName, generatedSessionName = "alice", false }},
+		{name: "role", change: func() { roleArn = "arn:aws:iam::123456789012:role/Dev" }},
+		{name: "tags", change: func() { sessionTags[0].Value = aws.String("y") }},
+		{name: "provider ID", change: func() { providerID = "www.amazon.com" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset()
+			tt.change()
+			if got := key(t, cfg); (got == want) != tt.same {
+				t.Errorf("sessionCacheFile() = %s, first %s, want same %v", got, want, tt.same)
+			}
+		})
+	}
+
+	t.Run("SSO source credentials", func(t *testing.T) {
+		url, account, role := ssoStartURL, ssoAccountID, ssoRoleName
+		t.Cleanup(func() { ssoStartURL, ssoAccountID, ssoRoleName = url, account, role })
+		reset()
+		ssoStartURL, ssoAccountID, ssoRoleName = "https://example.awsapps.com/start", "123456789012", "Developer"
+		keys := map[string]bool{}
+		for _, id := range []string{"ASIAFIRST", "ASIASECOND"} {
+			cfg := cfg
+			cfg.Credentials = credentials.NewStaticCredentialsProvider(id, "secret", "token")
+			keys[key(t, cfg)] = true
+		}
+		if len(keys) != 1 {
+			t.Errorf("sessionCacheFile() differs for new SSO sessions: %v", keys)
+		}
+		ssoRoleName = "Admin"
+		if keys[key(t, cfg)] {
+			t.Error("sessionCacheFile() is the same for another SSO role")
+		}
+	})
+
+	t.Run("source credentials", func(t *testing.T) {
+		reset()
+		cfg := cfg
+		cfg.Credentials = credentials.NewStaticCredentialsProvider("AKIAOTHER", "secret", "")
+		if key(t, cfg) == want {
+			t.Error("sessionCacheFile() is the same for other source credentials")
+		}
+	})
+}
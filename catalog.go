@@ -0,0 +1,342 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+const (
+	sourceToolConfig = "config"
+	sourceAWSConfig  = "aws-config"
+)
+
+type catalogEntry struct {
+	Name              string
+	Source            string
+	RoleArn           string
+	RoleSessionName   string
+	Duration          time.Duration
+	ExternalID        string
+	SerialNumber      string
+	SourceProfile     string
+	Region            string
+	Tags              []types.Tag
+	TransitiveTagKeys []string
+	PolicyArns        []string
+	Policy            string
+	RequireMFA        bool
+	DeriveIdentity    bool
+	IdentityTags      string
+}
+
+type catalog struct {
+	entries []*catalogEntry
+	byName  map[string]*catalogEntry
+}
+
+func (c *catalog) add(e *catalogEntry) {
+	if _, ok := c.byName[e.Name]; ok {
+		return
+	}
+	c.byName[e.Name] = e
+	c.entries = append(c.entries, e)
+}
+
+func (c *catalog) lookup(name string) (*catalogEntry, bool) {
+	e, ok := c.byName[name]
+	return e, ok
+}
+
+func (c *catalog) print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tROLE ARN\tSOURCE")
+	for _, e := range c.entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", e.Name, e.RoleArn, e.Source)
+	}
+	return tw.Flush()
+}
+
+func toolConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "aws-assume-role"), nil
+}
+
+func toolConfigFile() (string, error) {
+	if v := os.Getenv("AWS_ASSUME_ROLE_CONFIG"); v != "" {
+		return v, nil
+	}
+	dir, err := toolConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config"), nil
+}
+
+func awsConfigFile() (string, error) {
+	if v := os.Getenv("AWS_CONFIG_FILE"); v != "" {
+		return v, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".aws", "config"), nil
+}
+
+// loadCatalog merges the tool config and the role profiles of the shared AWS
+// config into a single namespace. Entries of the tool config take precedence.
+func loadCatalog() (*catalog, error) {
+	c := &catalog{byName: map[string]*catalogEntry{}}
+
+	name, err := toolConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	sections, err := readINIFile(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	roles, err := resolveToolConfig(sections)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	for _, s := range roles {
+		e, err := toolConfigEntry(name, strings.TrimPrefix(s.Name, "role "), s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		c.add(e)
+	}
+
+	name, err = awsConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	sections, err = readINIFile(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	var profiles []*catalogEntry
+	for _, s := range sections {
+		if s.get("role_arn") == "" {
+			continue
+		}
+		e, err := awsConfigEntry(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		profiles = append(profiles, e)
+	}
+	sort.SliceStable(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+	for _, e := range profiles {
+		c.add(e)
+	}
+
+	return c, nil
+}
+
+// resolveToolConfig returns the role sections of the tool config with
+// "extends" applied and "${var}" references expanded. Variables are looked up
+// in the role itself (including inherited keys), the [vars] section and the
+// builtin name and username.
+func resolveToolConfig(sections []*iniSection) ([]*iniSection, error) {
+	bases := map[string]*iniSection{}
+	vars := map[string]string{}
+	var roles []*iniSection
+	for _, s := range sections {
+		switch kind, name, _ := strings.Cut(s.Name, " "); {
+		case s.Name == "vars":
+			for k, v := range s.Values {
+				vars[k] = v
+			}
+		case kind == "role":
+			bases[name] = s
+			roles = append(roles, s)
+		case kind == "template":
+			bases[name] = s
+		}
+	}
+
+	var inherit func(s *iniSection, seen []string) (map[string]string, error)
+	inherit = func(s *iniSection, seen []string) (map[string]string, error) {
+		values := map[string]string{}
+		if base := s.get("extends"); base != "" {
+			if slices.Contains(seen, base) {
+				return nil, fmt.Errorf("%s: cyclic extends: %s", s.Name, strings.Join(append(seen, base), " -> "))
+			}
+			b, ok := bases[base]
+			if !ok {
+				return nil, fmt.Errorf("%s: extends unknown entry %q", s.Name, base)
+			}
+			bv, err := inherit(b, append(seen, base))
+			if err != nil {
+				return nil, err
+			}
+			values = bv
+		}
+		for k, v := range s.Values {
+			values[k] = v
+		}
+		delete(values, "extends")
+		return values, nil
+	}
+
+	username := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+
+	resolved := make([]*iniSection, 0, len(roles))
+	for _, s := range roles {
+		alias := strings.TrimPrefix(s.Name, "role ")
+		values, err := inherit(s, []string{alias})
+		if err != nil {
+			return nil, err
+		}
+		builtin := map[string]string{"name": alias, "username": username}
+		var expandErr error
+		lookup := func(k string) string {
+			// keep IAM policy variables such as ${aws:username}
+			if strings.Contains(k, ":") {
+				return "${" + k + "}"
+			}
+			if v, ok := values[k]; ok {
+				return v
+			}
+			if v, ok := vars[k]; ok {
+				return v
+			}
+			if v, ok := builtin[k]; ok {
+				return v
+			}
+			expandErr = fmt.Errorf("%s: undefined variable %q", s.Name, k)
+			return ""
+		}
+		r := &iniSection{Name: s.Name, Values: map[string]string{}}
+		for k, v := range values {
+			r.Keys = append(r.Keys, k)
+			r.Values[k] = os.Expand(v, lookup)
+		}
+		if expandErr != nil {
+			return nil, expandErr
+		}
+		sort.Strings(r.Keys)
+		resolved = append(resolved, r)
+	}
+	return resolved, nil
+}
+
+func toolConfigEntry(configFile, alias string, s *iniSection) (*catalogEntry, error) {
+	e := &catalogEntry{
+		Name:            alias,
+		Source:          sourceToolConfig,
+		RoleArn:         s.get("role_arn"),
+		RoleSessionName: s.get("role_session_name"),
+		ExternalID:      s.get("external_id"),
+		SerialNumber:    s.get("mfa_serial"),
+		SourceProfile:   s.get("source_profile"),
+		Region:          s.get("region"),
+	}
+	if v := s.get("duration"); v != "" {
+		d, err := parseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("role %s: invalid duration: %w", alias, err)
+		}
+		e.Duration = d
+	}
+	for _, kv := range splitList(s.get("tags")) {
+		k, v, found := strings.Cut(kv, "=")
+		if !found {
+			return nil, fmt.Errorf("role %s: invalid tag %q, must be key=value", alias, kv)
+		}
+		e.Tags = append(e.Tags, types.Tag{Key: aws.String(strings.TrimSpace(k)), Value: aws.String(strings.TrimSpace(v))})
+	}
+	e.TransitiveTagKeys = splitList(s.get("transitive_tag_keys"))
+	e.PolicyArns = splitList(s.get("policy_arns"))
+	e.Policy = s.get("policy")
+	if v := s.get("policy_file"); v != "" {
+		if e.Policy != "" {
+			return nil, fmt.Errorf("role %s: policy and policy_file are mutually exclusive", alias)
+		}
+		if !filepath.IsAbs(v) {
+			v = filepath.Join(filepath.Dir(configFile), v)
+		}
+		b, err := os.ReadFile(v)
+		if err != nil {
+			return nil, fmt.Errorf("role %s: %w", alias, err)
+		}
+		e.Policy = string(b)
+	}
+	if v := s.get("require_mfa"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("role %s: invalid require_mfa: %w", alias, err)
+		}
+		e.RequireMFA = b
+	}
+	if v := s.get("derive_identity"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("role %s: invalid derive_identity: %w", alias, err)
+		}
+		e.DeriveIdentity = b
+	}
+	e.IdentityTags = s.get("identity_tags")
+	if e.RoleArn == "" {
+		return nil, fmt.Errorf("role %s: role_arn is required", alias)
+	}
+	return e, nil
+}
+
+func awsConfigEntry(s *iniSection) (*catalogEntry, error) {
+	name := s.Name
+	if v, ok := strings.CutPrefix(name, "profile "); ok {
+		name = v
+	}
+	e := &catalogEntry{
+		Name:            name,
+		Source:          sourceAWSConfig,
+		RoleArn:         s.get("role_arn"),
+		RoleSessionName: s.get("role_session_name"),
+		ExternalID:      s.get("external_id"),
+		SerialNumber:    s.get("mfa_serial"),
+		SourceProfile:   s.get("source_profile"),
+		Region:          s.get("region"),
+	}
+	if v := s.get("duration_seconds"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: invalid duration_seconds: %w", name, err)
+		}
+		e.Duration = time.Duration(n) * time.Second
+	}
+	return e, nil
+}
+
+func splitList(v string) []string {
+	var list []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jsonLogWriter writes each log message as a JSON line.
+type jsonLogWriter struct {
+	w io.Writer
+}
+
+func (w jsonLogWriter) Write(p []byte) (int, error) {
+	b, err := json.Marshal(struct {
+		Time    string `json:"time"`
+		Message string `json:"message"`
+		CI      string `json:"ci,omitempty"`
+	}{
+		Time:    time.Now().UTC().Format(time.RFC3339),
+		Message: strings.TrimSuffix(string(p), "\n"),
+		CI:      detectCI(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.w.Write(append(b, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// setupCIMode enables -ci when a CI system is detected and -ci is not given
+// explicitly, and switches logs to JSON lines in CI mode.
+func setupCIMode() {
+	ciOnce.Do(setupCIModeOnce)
+}
+
+var ciOnce sync.Once
+
+func setupCIModeOnce() {
+	explicit := false
+	flag.Visit(func(f *flag.Flag) {
+		explicit = explicit || f.Name == "ci"
+	})
+	if !explicit && detectCI() != "" {
+		ciMode = true
+	}
+	if ciMode {
+		log.SetFlags(0)
+		log.SetOutput(jsonLogWriter{os.Stderr})
+	}
+	setupDebugBundle()
+}
+
+// requireInteraction fails in CI mode, where nobody can answer prompts.
+func requireInteraction(reason string) {
+	if ciMode {
+		fatalf("interaction required: %s", reason)
+	}
+}
@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+)
+
+// cleanups are run on every exit path of the process: returning from main,
+// fatal errors, signals and panics in the main goroutine.
+var cleanups struct {
+	sync.Mutex
+	fns []*func()
+}
+
+// atCleanup registers f and returns a function that runs it early and
+// unregisters it. f runs at most once.
+func atCleanup(f func()) func() {
+	var once sync.Once
+	run := func() { once.Do(f) }
+	// the entry is found by its address, since runCleanup may have taken
+	// the slice and later registrations reused the index
+	entry := &run
+	cleanups.Lock()
+	defer cleanups.Unlock()
+	cleanups.fns = append(cleanups.fns, entry)
+	return func() {
+		cleanups.Lock()
+		if i := slices.Index(cleanups.fns, entry); i >= 0 {
+			cleanups.fns[i] = nil
+		}
+		cleanups.Unlock()
+		run()
+	}
+}
+
+// runCleanup runs the registered functions in reverse order.
+func runCleanup() {
+	cleanups.Lock()
+	fns := cleanups.fns
+	cleanups.fns = nil
+	cleanups.Unlock()
+	for i := len(fns) - 1; i >= 0; i-- {
+		if fns[i] != nil {
+			(*fns[i])()
+		}
+	}
+}
+
+func exit(code int) {
+	runCleanup()
+	os.Exit(code)
+}
+
+// fatal and fatalf are log.Fatal and log.Fatalf running the cleanups.
+func fatal(v ...any) {
+	log.Print(v...)
+	writeDebugBundle(fmt.Sprint(v...))
+	exit(1)
+}
+
+func fatalf(format string, v ...any) {
+	log.Printf(format, v...)
+	writeDebugBundle(fmt.Sprintf(format, v...))
+	exit(1)
+}
+
+// cleanupOnSignal runs the cleanups and exits when the process is interrupted,
+// for modes that do not handle signals by themselves.
+func cleanupOnSignal() (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-ch:
+			code := 1
+			if s, ok := sig.(syscall.Signal); ok {
+				code = 128 + int(s)
+			}
+			exit(code)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
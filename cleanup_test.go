@@ -0,0 +1,199 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+func TestCleanup(t *testing.T) {
+	var ran []string
+	record := func(name string) func() {
+		return func() { ran = append(ran, name) }
+	}
+	atCleanup(record("first"))
+	second := atCleanup(record("second"))
+	atCleanup(record("third"))
+
+	second()
+	second()
+	if !slices.Equal(ran, []string{"second"}) {
+		t.Fatalf("early cleanup ran %q", ran)
+	}
+	runCleanup()
+	runCleanup()
+	second()
+	if want := []string{"second", "third", "first"}; !slices.Equal(ran, want) {
+		t.Errorf("cleanups ran %q, want %q", ran, want)
+	}
+}
+
+// cleanupMain registers a cleanup printing "cleanup" like main and leaves by
+// the path given by mode.
+func cleanupMain(mode string) {
+	defer runCleanup()
+	defer cleanupOnSignal()()
+	atCleanup(func() { fmt.Println("cleanup") })
+	switch mode {
+	case "exit":
+		exit(3)
+	case "fatal":
+		fatal("failed")
+	case "panic":
+		panic("failed")
+	case "signal":
+		fmt.Println("ready")
+		select {}
+	}
+}
+
+func TestCleanupExitPaths(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		mode string
+		code int
+	}{
+		{mode: "return", code: 0},
+		{mode: "exit", code: 3},
+		{mode: "fatal", code: 1},
+		{mode: "panic", code: 2},
+		{mode: "signal", code: 128 + int(syscall.SIGINT)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			if tt.mode == "signal" && runtime.GOOS == "windows" {
+				t.Skip("interrupts cannot be sent on windows")
+			}
+			cmd := exec.Command(exe)
+			cmd.Env = append(os.Environ(), "AWS_ASSUME_ROLE_TEST_CLEANUP="+tt.mode)
+			stdout, err := cmd.StdoutPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			r := bufio.NewReader(stdout)
+			if tt.mode == "signal" {
+				if line, _ := r.ReadString('\n'); line != "ready\n" {
+					t.Fatalf("read %q before the signal", line)
+				}
+				cmd.Process.Signal(os.Interrupt)
+			}
+			out, _ := r.ReadString(0)
+			cmd.Wait()
+			if out != "cleanup\n" || cmd.ProcessState.ExitCode() != tt.code {
+				t.Errorf("printed %q and exited with %d, want %q and %d", out, cmd.ProcessState.ExitCode(), "cleanup\n", tt.code)
+			}
+		})
+	}
+}
+
+// TestTempProfileRemoved runs the tool with -temp-profile and checks that the
+// directory of the profile is gone however the command ends.
+func TestTempProfileRemoved(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(&fakeSTS{})
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{name: "success", script: `dirname "$AWS_CONFIG_FILE"`},
+		{name: "failure", script: `dirname "$AWS_CONFIG_FILE"; exit 3`},
+		{name: "signal", script: `dirname "$AWS_CONFIG_FILE"; kill -TERM $PPID; exec sleep 10`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "signal" && runtime.GOOS == "windows" {
+				t.Skip("signals cannot be sent on windows")
+			}
+			cmd := exec.Command(exe, "-endpoint-url", srv.URL, "-rate-limit", "0", "-no-cache",
+				"-role-arn", "arn:aws:iam::123456789012:role/Dev", "-temp-profile", "dev", "--", "sh", "-c", tt.script)
+			cmd.Env = toolEnv(t, srv)
+			out, _ := cmd.Output()
+			dir := strings.TrimSpace(string(out))
+			if !strings.Contains(filepath.Base(dir), "aws-assume-role-") {
+				t.Fatalf("the command printed %q", out)
+			}
+			if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("%s is not removed: %v", dir, err)
+			}
+		})
+	}
+}
+
+func TestCredentialServerClosed(t *testing.T) {
+	creds := &types.Credentials{
+		AccessKeyId:     aws.String("ASIAEXAMPLE"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	}
+	env, err := startCredentialServer(context.Background(), creds, func(context.Context) (*types.Credentials, error) {
+		return creds, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uri string
+	for _, e := range env {
+		if v, ok := strings.CutPrefix(e, "AWS_CONTAINER_CREDENTIALS_FULL_URI="); ok {
+			uri = v
+		}
+	}
+	resp, err := http.Get(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	runCleanup()
+	if resp, err := http.Get(uri); err == nil {
+		resp.Body.Close()
+		t.Errorf("the server still answers %s after the cleanups", resp.Status)
+	}
+}
+
+// TestServeSocketRemoved stops serve with a signal and checks that its socket
+// is removed.
+func TestServeSocketRemoved(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals cannot be sent on windows")
+	}
+	srv := httptest.NewServer(&fakeSTS{})
+	defer srv.Close()
+
+	cmd, socket := startServe(t, toolEnv(t, srv), "-role-arn", "arn:aws:iam::123456789012:role/Dev")
+	cmd.Process.Signal(syscall.SIGTERM)
+	cmd.Wait()
+	if _, err := os.Stat(socket); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("%s is not removed: %v", socket, err)
+	}
+}
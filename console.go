@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// consoleEndpoints are the federation and console endpoints of each partition.
+var consoleEndpoints = map[string][2]string{
+	"aws":        {"https://signin.aws.amazon.com/federation", "https://console.aws.amazon.com/"},
+	"aws-cn":     {"https://signin.amazonaws.cn/federation", "https://console.amazonaws.cn/"},
+	"aws-us-gov": {"https://signin.amazonaws-us-gov.com/federation", "https://console.amazonaws-us-gov.com/"},
+}
+
+// consoleURL exchanges the credentials for a sign-in token of the federation
+// endpoint and returns the URL signing in to the console at destination, a
+// path such as "s3" or "ec2/home?region=us-east-1". The console session lasts
+// as long as the role session.
+func consoleURL(ctx context.Context, region string, creds *types.Credentials, destination string) (string, error) {
+	endpoints := consoleEndpoints[partition(region)]
+	session, err := json.Marshal(map[string]string{
+		"sessionId":    *creds.AccessKeyId,
+		"sessionKey":   *creds.SecretAccessKey,
+		"sessionToken": *creds.SessionToken,
+	})
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{"Action": {"getSigninToken"}, "Session": {string(session)}}
+	var token struct {
+		SigninToken string
+	}
+	err = withRetry(ctx, "GetSigninToken", func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoints[0]+"?"+q.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := sharedHTTPClient().Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("federation endpoint: %s", resp.Status)
+		}
+		return json.NewDecoder(resp.Body).Decode(&token)
+	})
+	if err != nil {
+		return "", err
+	}
+	q = url.Values{
+		"Action":      {"login"},
+		"Issuer":      {"aws-assume-role"},
+		"Destination": {endpoints[1] + strings.TrimPrefix(destination, "/")},
+		"SigninToken": {token.SigninToken},
+	}
+	return endpoints[0] + "?" + q.Encode(), nil
+}
+
+// openBrowser opens u with the default browser of the desktop.
+func openBrowser(u string) error {
+	var cmd *exec.Cmd
+	switch {
+	case runtime.GOOS == "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	case runtime.GOOS == "darwin":
+		cmd = exec.Command("open", u)
+	case isWSL():
+		cmd = exec.Command("wslview", u)
+	default:
+		cmd = exec.Command("xdg-open", u)
+	}
+	return cmd.Run()
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dirDefaultFile is looked up from the working directory towards the root and
+// takes precedence over the per user default.
+const dirDefaultFile = ".aws-assume-role"
+
+func userDefaultFile() (string, error) {
+	dir, err := toolConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "current"), nil
+}
+
+func readDefaultFile(name string) (string, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// currentDefault returns the default role name and the file it was read from.
+// Directory defaults take precedence over rules of the tool config, which
+// take precedence over the user default. It returns an empty name when no
+// default is set.
+func currentDefault() (string, string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", "", err
+	}
+	for {
+		name := filepath.Join(dir, dirDefaultFile)
+		v, err := readDefaultFile(name)
+		if err == nil && v != "" {
+			return v, name, nil
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	if v, rule, err := selectRole(); err != nil || v != "" {
+		return v, rule, err
+	}
+
+	name, err := userDefaultFile()
+	if err != nil {
+		return "", "", err
+	}
+	v, err := readDefaultFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return v, name, nil
+}
+
+func runUse(args []string) error {
+	flags := flag.NewFlagSet("use", flag.ExitOnError)
+	dir := flags.Bool("dir", false, "set the default for the working directory instead of the user")
+	unset := flags.Bool("unset", false, "remove the default")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s use [-dir] [-unset] [NAME]\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	var name string
+	if *dir {
+		name = dirDefaultFile
+	} else {
+		var err error
+		name, err = userDefaultFile()
+		if err != nil {
+			return err
+		}
+	}
+
+	if *unset {
+		if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		exit(2)
+	}
+	role := flags.Arg(0)
+	c, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	if _, ok := c.lookup(role); !ok {
+		return fmt.Errorf("role %q is not found in the catalog", role)
+	}
+	return writeFileAtomic(name, []byte(role+"\n"))
+}
+
+func runCurrent(args []string) error {
+	flags := flag.NewFlagSet("current", flag.ExitOnError)
+	verbose := flags.Bool("v", false, "also print the file the default is read from")
+	flags.Parse(args)
+
+	name, source, err := currentDefault()
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return errors.New("no default role, set one with use")
+	}
+	if *verbose {
+		fmt.Printf("%s\t%s\n", name, source)
+	} else {
+		fmt.Println(name)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// debugAttempt is a call to AWS recorded for the debug bundle.
+type debugAttempt struct {
+	Time      time.Time `json:"time"`
+	Name      string    `json:"name"`
+	Attempt   int       `json:"attempt"`
+	Duration  string    `json:"duration"`
+	Error     string    `json:"error,omitempty"`
+	Class     string    `json:"class,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+var debugState struct {
+	sync.Mutex
+	attempts  []debugAttempt
+	endpoints []string
+	region    string
+	log       bytes.Buffer
+}
+
+// secretFlags are redacted in the debug bundle.
+var secretFlags = []string{"token-code", "external-id", "totp-secret"}
+
+// setupDebugBundle captures the log for the debug bundle.
+func setupDebugBundle() {
+	if debugBundle != "" {
+		log.SetOutput(io.MultiWriter(log.Writer(), debugLogWriter{}))
+	}
+}
+
+type debugLogWriter struct{}
+
+func (debugLogWriter) Write(p []byte) (int, error) {
+	debugState.Lock()
+	defer debugState.Unlock()
+	return debugState.log.Write(p)
+}
+
+// requestID returns the AWS request ID of err, if any.
+func requestID(err error) string {
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.ServiceRequestID()
+	}
+	return ""
+}
+
+func recordAttempt(name string, attempt int, start time.Time, err error) {
+	a := debugAttempt{Time: start.UTC(), Name: name, Attempt: attempt, Duration: time.Since(start).String()}
+	if err != nil {
+		a.Error = err.Error()
+		a.Class = classifyError(err).String()
+		a.RequestID = requestID(err)
+	}
+	debugState.Lock()
+	defer debugState.Unlock()
+	debugState.attempts = append(debugState.attempts, a)
+}
+
+// recordEndpoint is an API option recording the endpoints of the requests.
+func recordEndpoint(stack *middleware.Stack) error {
+	return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("RecordEndpoint", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		if req, ok := in.Request.(*smithyhttp.Request); ok {
+			endpoint := req.URL.Scheme + "://" + req.URL.Host
+			debugState.Lock()
+			if !slices.Contains(debugState.endpoints, endpoint) {
+				debugState.endpoints = append(debugState.endpoints, endpoint)
+			}
+			debugState.Unlock()
+		}
+		return next.HandleFinalize(ctx, in)
+	}), middleware.After)
+}
+
+// redactEnv returns the AWS related environment with secrets redacted.
+func redactEnv() map[string]string {
+	env := map[string]string{}
+	for _, e := range os.Environ() {
+		k, v, _ := strings.Cut(e, "=")
+		if !strings.HasPrefix(k, "AWS_") && k != "CI" && !strings.HasPrefix(k, "GITHUB_") {
+			continue
+		}
+		upper := strings.ToUpper(k)
+		if slices.Contains(credentialKeys, k) || strings.Contains(upper, "SECRET") || strings.Contains(upper, "TOKEN") || strings.Contains(upper, "PASSWORD") {
+			v = "REDACTED"
+		}
+		env[k] = v
+	}
+	return env
+}
+
+// writeDebugBundle writes a gzipped tar archive describing the failed
+// invocation to the -debug-bundle path. Secrets are redacted.
+func writeDebugBundle(failure string) {
+	if debugBundle == "" {
+		return
+	}
+	flags := map[string]string{}
+	flag.Visit(func(f *flag.Flag) {
+		v := f.Value.String()
+		if slices.Contains(secretFlags, f.Name) {
+			v = "REDACTED"
+		}
+		flags[f.Name] = v
+	})
+	version := "unknown"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		version = info.Main.Version
+	}
+
+	debugState.Lock()
+	report, err := json.MarshalIndent(map[string]any{
+		"version":  version,
+		"go":       runtime.Version(),
+		"platform": runtime.GOOS + "/" + runtime.GOARCH,
+		"args":     len(os.Args) - 1,
+		"error":    failure,
+		"config": map[string]any{
+			"flags":           flags,
+			"role_arn":        roleArn,
+			"role":            roleName,
+			"duration":        (*durationValue)(&duration).String(),
+			"session_tags":    len(sessionTags),
+			"policy_arns":     policyArns,
+			"inline_policy":   policy != "",
+			"ci":              ciMode,
+			"region":          debugState.region,
+			"retry_attempts":  retryMaxAttempts,
+			"retry_budget":    retryBudgetSize,
+			"rate_limit":      rateLimit,
+			"source_identity": sourceIdentity,
+		},
+		"environment": redactEnv(),
+		"endpoints":   debugState.endpoints,
+		"attempts":    debugState.attempts,
+	}, "", "  ")
+	logs := debugState.log.Bytes()
+	debugState.Unlock()
+	if err != nil {
+		log.Printf("debug bundle: %v", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{
+		{"report.json", report},
+		{"log.txt", logs},
+	} {
+		tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o600, Size: int64(len(f.data)), ModTime: time.Now()})
+		tw.Write(f.data)
+	}
+	tw.Close()
+	zw.Close()
+	if err := writeFileAtomic(debugBundle, buf.Bytes()); err != nil {
+		log.Printf("debug bundle: %v", err)
+		return
+	}
+	log.Printf("wrote the debug bundle to %s, review it before sharing", debugBundle)
+}
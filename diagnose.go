@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/smithy-go"
+)
+
+// diagnosedError adds an explanation and next steps to an SDK error.
+type diagnosedError struct {
+	err  error
+	hint string
+}
+
+func (e *diagnosedError) Error() string {
+	return e.err.Error() + "\n\n" + e.hint
+}
+
+func (e *diagnosedError) Unwrap() error {
+	return e.err
+}
+
+// diagnose adds the request ID to err and explains the common failures of
+// sts:AssumeRole.
+func diagnose(err error) error {
+	var hints []string
+	if id := requestID(err); id != "" {
+		hints = append(hints, "STS request ID: "+id)
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		hints = append(hints, diagnoseCode(apiErr.ErrorCode())...)
+	}
+	if debugBundle == "" {
+		hints = append(hints, "Rerun with -debug-bundle FILE to write a redacted diagnostic archive for an issue.")
+	}
+	if len(hints) == 0 {
+		return err
+	}
+	return &diagnosedError{err: err, hint: strings.Join(hints, "\n")}
+}
+
+// diagnoseCode returns explanations and next steps for an STS error code.
+func diagnoseCode(code string) []string {
+	var hints []string
+	switch code {
+	case "AccessDenied":
+		hints = append(hints,
+			"STS refused to let the source credentials assume "+roleArn+". Check that:",
+			"  - the trust policy of the role trusts the source principal (-preflight explains mismatches)",
+			"  - the identity policy of the source principal allows sts:AssumeRole on the role",
+		)
+		if externalID == "" {
+			hints = append(hints, "  - the role does not require an external ID (-external-id)")
+		}
+		if serialNumber == "" {
+			hints = append(hints, "  - the role does not require MFA (-serial-number and -token-code)")
+		}
+		if len(sessionTags) > 0 {
+			hints = append(hints, "  - both policies allow sts:TagSession, since session tags are requested")
+		}
+		if sourceIdentity != "" {
+			hints = append(hints, "  - both policies allow sts:SetSourceIdentity, since a source identity is requested")
+		}
+	case "MalformedPolicyDocument":
+		hints = append(hints, "The session policy (-policy, policy or policy_file) is not a valid IAM policy document. Validate it with IAM Access Analyzer, e.g. aws accessanalyzer validate-policy --policy-type IDENTITY_POLICY --policy-document file://policy.json")
+	case "PackedPolicyTooLarge":
+		hints = append(hints, "The session policies and tags exceed the packed size limit. Use fewer or shorter session tags, managed session policies (policy_arns) instead of a large inline policy, or fewer policy ARNs.")
+	case "ExpiredToken", "ExpiredTokenException":
+		hints = append(hints, "The source credentials have expired. Refresh them (e.g. aws sso login, or renew the outer session) and retry.")
+		if chain {
+			hints = append(hints, "With -chain the source credentials are the ones issued by the outer aws-assume-role, start a new one instead.")
+		}
+	case "InvalidClientTokenId":
+		hints = append(hints, "The source access key does not exist or is not valid in this partition. Check AWS_PROFILE and the environment for stale AWS_ACCESS_KEY_ID values.")
+	case "RegionDisabledException":
+		hints = append(hints, "STS is not activated in the region of the request. Set AWS_REGION to a region enabled for the account, or activate the region in the IAM console (Account settings, Security Token Service).")
+	}
+	return hints
+}
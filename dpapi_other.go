@@ -0,0 +1,10 @@
+// SPDX-License-Identifier: MIT
+//go:build !windows
+
+package main
+
+import "errors"
+
+func protectData(b []byte) ([]byte, error) {
+	return nil, errors.New("the AWS SDK Store is only available on Windows")
+}
@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: MIT
+//go:build windows
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modcrypt32           = syscall.NewLazyDLL("crypt32.dll")
+	procCryptProtectData = modcrypt32.NewProc("CryptProtectData")
+	procLocalFree        = modkernel32.NewProc("LocalFree")
+)
+
+const cryptprotectUIForbidden = 0x1
+
+type dataBlob struct {
+	cbData uint32
+	pbData *byte
+}
+
+// protectData encrypts b with DPAPI for the current user.
+func protectData(b []byte) ([]byte, error) {
+	in := dataBlob{cbData: uint32(len(b))}
+	if len(b) > 0 {
+		in.pbData = &b[0]
+	}
+	var out dataBlob
+	r, _, err := procCryptProtectData.Call(uintptr(unsafe.Pointer(&in)), 0, 0, 0, 0, cryptprotectUIForbidden, uintptr(unsafe.Pointer(&out)))
+	if r == 0 {
+		return nil, err
+	}
+	defer procLocalFree.Call(uintptr(unsafe.Pointer(out.pbData)))
+	return append([]byte(nil), unsafe.Slice(out.pbData, out.cbData)...), nil
+}
@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/smithy-go"
+)
+
+// durationMax requests the maximum session duration of the role.
+const durationMax time.Duration = -1
+
+// negotiatedDurations are tried in order when the maximum session duration
+// cannot be read from IAM.
+var negotiatedDurations = []time.Duration{
+	12 * time.Hour,
+	8 * time.Hour,
+	6 * time.Hour,
+	4 * time.Hour,
+	2 * time.Hour,
+	time.Hour,
+}
+
+// durationValue is a flag.Value of a time.Duration that also accepts "max".
+type durationValue time.Duration
+
+func (d *durationValue) String() string {
+	if time.Duration(*d) == durationMax {
+		return "max"
+	}
+	return time.Duration(*d).String()
+}
+
+func (d *durationValue) Set(s string) error {
+	v, err := parseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = durationValue(v)
+	return nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if s == "max" {
+		return durationMax, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// maxSessionDuration reads the MaxSessionDuration of the role with the source
+// credentials of account, which can only read their own roles.
+func maxSessionDuration(ctx context.Context, cfg aws.Config, arn, account string) (time.Duration, error) {
+	name, err := localRoleName(arn, account)
+	if err != nil {
+		return 0, err
+	}
+	client := iam.NewFromConfig(cfg, func(o *iam.Options) {
+		o.Retryer = aws.NopRetryer{}
+	})
+	var out *iam.GetRoleOutput
+	err = withRetry(ctx, "GetRole", func(ctx context.Context) error {
+		var err error
+		out, err = client.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(name)})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if aws.ToString(out.Role.Arn) != arn {
+		return 0, fmt.Errorf("the role %s of the account has another path", aws.ToString(out.Role.Arn))
+	}
+	return time.Duration(aws.ToInt32(out.Role.MaxSessionDuration)) * time.Second, nil
+}
+
+// isDurationTooLong reports if STS refused the requested DurationSeconds, e.g.
+// beyond the MaxSessionDuration or the 1 hour limit of role chaining.
+func isDurationTooLong(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "ValidationError" && strings.Contains(apiErr.ErrorMessage(), "DurationSeconds")
+}
+
+// candidateDurations returns the durations to request for -duration max.
+func candidateDurations(ctx context.Context, cfg aws.Config, chained bool) []time.Duration {
+	id, err := callerIdentity(ctx, cfg)
+	if err != nil {
+		log.Printf("cannot read the maximum session duration of %s, negotiating with STS: %v", roleArn, err)
+		return negotiatedDurations
+	}
+	account, _ := accountIDFromArn(aws.ToString(id.Arn))
+	d, err := maxSessionDuration(ctx, cfg, roleArn, account)
+	if err != nil {
+		log.Printf("cannot read the maximum session duration of %s, negotiating with STS: %v", roleArn, err)
+		return negotiatedDurations
+	}
+	durations := []time.Duration{d}
+	if (chained || strings.Contains(aws.ToString(id.Arn), ":assumed-role/")) && d > time.Hour {
+		// STS limits sessions of role chaining to 1 hour
+		durations = append(durations, time.Hour)
+	}
+	return durations
+}
@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		err  bool
+	}{
+		{in: "max", want: durationMax},
+		{in: "1h", want: time.Hour},
+		{in: "1h30m", want: 90 * time.Minute},
+		{in: "900s", want: 15 * time.Minute},
+		{in: "MAX", err: true},
+		{in: "3600", err: true},
+		{in: "", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v, want %v (error %v)", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestDurationValue(t *testing.T) {
+	for _, s := range []string{"max", "2h0m0s"} {
+		var d durationValue
+		if err := d.Set(s); err != nil {
+			t.Fatal(err)
+		}
+		if d.String() != s {
+			t.Errorf("durationValue %q = %q", s, d.String())
+		}
+	}
+}
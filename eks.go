@@ -0,0 +1,222 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"gopkg.in/yaml.v3"
+)
+
+// eksFlags are not forwarded to the exec block of the kubeconfig.
+var eksFlags = []string{"cluster", "kubeconfig", "alias", "token-code", "select", "select-from", "select-role-name"}
+
+func runEKS(args []string) error {
+	usage := func() {
+		fmt.Fprintf(
+			os.Stderr,
+			"Usage: %s eks kubeconfig|token -cluster NAME [FLAGS...]\n\n"+
+				"  aws-assume-role eks kubeconfig -role prod-admin -cluster main\n\n",
+			os.Args[0],
+		)
+		flag.PrintDefaults()
+		exit(2)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+	cluster := flag.String("cluster", "", "EKS cluster name (required)")
+	kubeconfig := flag.String("kubeconfig", "", "kubeconfig to update (default $KUBECONFIG or ~/.kube/config)")
+	alias := flag.String("alias", "", "name of the context (default cluster ARN)")
+	flag.CommandLine.Parse(args[1:])
+	if *cluster == "" {
+		usage()
+	}
+
+	ctx := context.Background()
+	helperMode = true
+	loadOpts := resolveRole(ctx)
+	role, cfg, err := assumeRole(ctx, loadOpts)
+	if err != nil {
+		return err
+	}
+	creds := role.Credentials
+	cfg.Credentials = credentials.NewStaticCredentialsProvider(*creds.AccessKeyId, *creds.SecretAccessKey, *creds.SessionToken)
+
+	switch args[0] {
+	case "token":
+		return printEKSToken(ctx, cfg, *cluster)
+	case "kubeconfig":
+		return writeKubeconfig(ctx, cfg, *cluster, *kubeconfig, *alias)
+	}
+	usage()
+	return nil
+}
+
+// printEKSToken prints an ExecCredential with a token accepted by the
+// aws-iam-authenticator of EKS: a presigned sts:GetCallerIdentity URL bound to
+// the cluster name.
+func printEKSToken(ctx context.Context, cfg aws.Config, cluster string) error {
+	presigner := sts.NewPresignClient(sts.NewFromConfig(cfg))
+	req, err := presigner.PresignGetCallerIdentity(ctx, &sts.GetCallerIdentityInput{}, func(o *sts.PresignOptions) {
+		o.ClientOptions = append(o.ClientOptions, func(o *sts.Options) {
+			o.APIOptions = append(o.APIOptions, smithyhttp.SetHeaderValue("x-k8s-aws-id", cluster), addEKSTokenExpires)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	type status struct {
+		ExpirationTimestamp string `json:"expirationTimestamp"`
+		Token               string `json:"token"`
+	}
+	return json.NewEncoder(os.Stdout).Encode(struct {
+		Kind       string   `json:"kind"`
+		APIVersion string   `json:"apiVersion"`
+		Spec       struct{} `json:"spec"`
+		Status     status   `json:"status"`
+	}{
+		Kind:       "ExecCredential",
+		APIVersion: "client.authentication.k8s.io/v1beta1",
+		Status: status{
+			// presigned URLs are valid for 15 minutes, refresh a bit earlier
+			ExpirationTimestamp: time.Now().Add(14 * time.Minute).UTC().Format(time.RFC3339),
+			Token:               "k8s-aws-v1." + base64.RawURLEncoding.EncodeToString([]byte(req.URL)),
+		},
+	})
+}
+
+func addEKSTokenExpires(stack *middleware.Stack) error {
+	return stack.Build.Add(middleware.BuildMiddlewareFunc("EKSTokenExpires", func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+		if req, ok := in.Request.(*smithyhttp.Request); ok {
+			q := req.URL.Query()
+			q.Set("X-Amz-Expires", "60")
+			req.URL.RawQuery = q.Encode()
+		}
+		return next.HandleBuild(ctx, in)
+	}), middleware.After)
+}
+
+func writeKubeconfig(ctx context.Context, cfg aws.Config, cluster, name, alias string) error {
+	out, err := eks.NewFromConfig(cfg).DescribeCluster(ctx, &eks.DescribeClusterInput{Name: aws.String(cluster)})
+	if err != nil {
+		return err
+	}
+	c := out.Cluster
+	if alias == "" {
+		alias = *c.Arn
+	}
+
+	if kind, _, _ := strings.Cut(totpSecret, ":"); totpSecret != "" && kind != "env" && kind != "file" {
+		// the exec block is written to the kubeconfig in plain text
+		return errors.New("-totp-secret must be an env:NAME or file:PATH reference with eks kubeconfig")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	execArgs := []any{"eks", "token", "-cluster", cluster}
+	flag.Visit(func(f *flag.Flag) {
+		if slices.Contains(eksFlags, f.Name) {
+			return
+		}
+		if v, ok := f.Value.(*repeatedValue); ok {
+			for _, e := range *v.values {
+				execArgs = append(execArgs, "-"+f.Name+"="+e)
+			}
+			return
+		}
+		if v, ok := f.Value.(*tagValue); ok {
+			for _, t := range *v {
+				execArgs = append(execArgs, "-"+f.Name+"="+*t.Key+"="+*t.Value)
+			}
+			return
+		}
+		execArgs = append(execArgs, "-"+f.Name+"="+f.Value.String())
+	})
+	if roleName != "" && !slices.Contains(execArgs, any("-role="+roleName)) {
+		execArgs = append(execArgs, "-role="+roleName)
+	}
+	if selectMode && roleName == "" {
+		// the role picked with -select
+		execArgs = append(execArgs, "-role-arn="+roleArn)
+	}
+	execBlock := map[string]any{
+		"apiVersion": "client.authentication.k8s.io/v1beta1",
+		"command":    exe,
+		"args":       execArgs,
+		"env":        []any{map[string]any{"name": "AWS_REGION", "value": cfg.Region}},
+	}
+
+	if name == "" {
+		name = kubeconfigFile()
+	}
+	kc := map[string]any{}
+	b, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := yaml.Unmarshal(b, &kc); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if kc["apiVersion"] == nil {
+		kc["apiVersion"] = "v1"
+		kc["kind"] = "Config"
+	}
+	upsertNamed(kc, "clusters", alias, "cluster", map[string]any{
+		"server":                     *c.Endpoint,
+		"certificate-authority-data": *c.CertificateAuthority.Data,
+	})
+	upsertNamed(kc, "users", alias, "user", map[string]any{"exec": execBlock})
+	upsertNamed(kc, "contexts", alias, "context", map[string]any{"cluster": alias, "user": alias})
+	kc["current-context"] = alias
+
+	b, err = yaml.Marshal(kc)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(name, b); err != nil {
+		return err
+	}
+	log.Printf("updated context %s in %s", alias, name)
+	return nil
+}
+
+func kubeconfigFile() string {
+	if v := os.Getenv("KUBECONFIG"); v != "" {
+		return filepath.SplitList(v)[0]
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".kube", "config")
+}
+
+// upsertNamed replaces or appends the entry called name in the kubeconfig list
+// key, e.g. {"name": name, "cluster": value} in "clusters".
+func upsertNamed(kc map[string]any, key, name, field string, value map[string]any) {
+	list, _ := kc[key].([]any)
+	entry := map[string]any{"name": name, field: value}
+	for i, v := range list {
+		if m, ok := v.(map[string]any); ok && m["name"] == name {
+			list[i] = entry
+			return
+		}
+	}
+	kc[key] = append(list, entry)
+}
@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// endpointOptions returns the options of -region, -fips, -endpoint-url and
+// -sts-regional-endpoint for loading the config. They come after the options
+// of the catalog entry, which they override.
+func endpointOptions() ([]func(*config.LoadOptions) error, error) {
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	if fips {
+		opts = append(opts, config.WithUseFIPSEndpoint(aws.FIPSEndpointStateEnabled))
+	}
+	switch stsRegionalEndpoint {
+	case "", "regional", "legacy":
+	default:
+		return nil, fmt.Errorf("invalid -sts-regional-endpoint %q, must be regional or legacy", stsRegionalEndpoint)
+	}
+	if endpointURL == "" && stsRegionalEndpoint != "legacy" {
+		return opts, nil
+	}
+	// other services keep their default endpoints
+	resolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...any) (aws.Endpoint, error) {
+		switch {
+		case service != sts.ServiceID:
+		case endpointURL != "":
+			return aws.Endpoint{URL: endpointURL, SigningRegion: region}, nil
+		case partition(region) == "aws":
+			// the global endpoint, as before regional endpoints became the default
+			return aws.Endpoint{URL: "https://sts.amazonaws.com", SigningRegion: "us-east-1"}, nil
+		}
+		return aws.Endpoint{}, &aws.EndpointNotFoundError{}
+	})
+	return append(opts, config.WithEndpointResolverWithOptions(resolver)), nil
+}
@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// markerKey holds the ARN of the role assumed by this tool, to detect
+// invocations nested in the environment of another one.
+const markerKey = "AWS_ASSUME_ROLE_ARN"
+
+// helperMode is set by the subcommands delivering the credentials to other
+// tools or to the cache, like git-credential, eks and warm, which may run in
+// the environment of another invocation.
+var helperMode bool
+
+// replacesCredentials reports if the credentials are delivered instead of
+// running commands with them: exports replace the credentials of the current
+// shell, and helpers answer for other tools. Nested invocations then assume
+// the role from the original credentials like with -force.
+func replacesCredentials() bool {
+	return helperMode || printExport || output != "" || githubEnv || console || consoleOpen || sdkStore != "" || writeProfile != ""
+}
+
+// credentialKeys are exported with the issued credentials.
+var credentialKeys = []string{
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	markerKey,
+	stackKey,
+	depthKey,
+}
+
+// conflictingKeys would make SDKs prefer another source over the issued
+// credentials, so they are removed from the environment.
+var conflictingKeys = []string{
+	"AWS_ROLE_ARN",
+	"AWS_WEB_IDENTITY_TOKEN_FILE",
+}
+
+func shellSyntax(shell string) (string, error) {
+	switch shell {
+	case "sh", "bash", "zsh", "dash", "ksh", "ash":
+		return "sh", nil
+	case "fish":
+		return "fish", nil
+	case "powershell", "pwsh":
+		return "powershell", nil
+	}
+	return "", fmt.Errorf("unsupported shell %q", shell)
+}
+
+// detectShell guesses the shell evaluating the output of -print-export from
+// the parent process, which is the shell itself for eval "$(...)", then from
+// $SHELL.
+func detectShell() string {
+	for _, name := range []string{parentProcessName(), os.Getenv("SHELL")} {
+		name = strings.TrimPrefix(strings.ToLower(filepath.Base(name)), "-") // login shells
+		name = strings.TrimSuffix(name, ".exe")
+		if _, err := shellSyntax(name); err == nil {
+			return name
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return "powershell"
+	}
+	return "sh"
+}
+
+func printExports(w io.Writer, shell string, env []string) error {
+	syntax, err := shellSyntax(shell)
+	if err != nil {
+		return err
+	}
+	for _, e := range env {
+		k, v, _ := strings.Cut(e, "=")
+		switch syntax {
+		case "sh":
+			fmt.Fprintf(w, "export %s=%s\n", k, shQuote(v))
+		case "fish":
+			fmt.Fprintf(w, "set -gx %s %s\n", k, fishQuote(v))
+		case "powershell":
+			fmt.Fprintf(w, "$env:%s = %s\n", k, psQuote(v))
+		}
+	}
+	return printUnsets(w, syntax, conflictingKeys)
+}
+
+func printUnsets(w io.Writer, shell string, keys []string) error {
+	syntax, err := shellSyntax(shell)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		switch syntax {
+		case "sh":
+			fmt.Fprintf(w, "unset %s\n", k)
+		case "fish":
+			fmt.Fprintf(w, "set -e %s\n", k)
+		case "powershell":
+			fmt.Fprintf(w, "Remove-Item Env:%s -ErrorAction SilentlyContinue\n", k)
+		}
+	}
+	return nil
+}
+
+func shQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func printCredentials(w io.Writer, format string, creds *types.Credentials) error {
+	switch format {
+	case "json":
+		return json.NewEncoder(w).Encode(struct {
+			Version         int
+			AccessKeyId     string
+			SecretAccessKey string
+			SessionToken    string
+			Expiration      string
+		}{
+			Version:         1,
+			AccessKeyId:     *creds.AccessKeyId,
+			SecretAccessKey: *creds.SecretAccessKey,
+			SessionToken:    *creds.SessionToken,
+			Expiration:      creds.Expiration.Format(time.RFC3339),
+		})
+	case "powershell":
+		// AWS Tools for PowerShell
+		_, err := fmt.Fprintf(w, "Set-AWSCredential -AccessKey %s -SecretKey %s -SessionToken %s\n", psQuote(*creds.AccessKeyId), psQuote(*creds.SecretAccessKey), psQuote(*creds.SessionToken))
+		return err
+	case "java":
+		_, err := fmt.Fprintln(w, strings.Join(javaProperties(creds), " "))
+		return err
+	}
+	return fmt.Errorf("unsupported output format %q", format)
+}
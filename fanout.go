@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// fanoutExclusive are the flags delivering the credentials otherwise than to
+// the commands of a fan-out.
+var fanoutExclusive = []string{"print-export", "output", "github-env", "console", "console-open", "sdk-store", "refresh", "temp-profile", "java-tool-options", "summary-fd", "summary-file", "write-profile", "tty"}
+
+// fanoutTargets returns the roles of -role-arns-file, one ARN per line with #
+// comments, or the repeated -role-arn of -fanout.
+func fanoutTargets() ([]string, error) {
+	if roleArnsFile == "" {
+		return slices.Clone(roleArns), nil
+	}
+	b, err := os.ReadFile(roleArnsFile)
+	if err != nil {
+		return nil, err
+	}
+	targets := slices.Clone(roleArns)
+	for _, line := range strings.Split(string(b), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		if line = strings.TrimSpace(line); line != "" {
+			targets = append(targets, line)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s has no roles", roleArnsFile)
+	}
+	return targets, nil
+}
+
+// fanoutLabel prefixes the output of the command run with arn: the account
+// and the role name.
+func fanoutLabel(arn string) string {
+	account, _ := accountIDFromArn(arn)
+	return account + "/" + arn[strings.LastIndex(arn, "/")+1:]
+}
+
+// prefixWriter writes the complete lines of the command to w, prefixed with
+// its label. The writers of all commands share mu so lines never interleave.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, "[%s] %s", p.prefix, line)
+}
+
+// Flush writes the last line when the command did not end it.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.writeLine(append(p.buf, '\n'))
+		p.buf = nil
+	}
+}
+
+// runFanout runs args once per role of targets, at most -parallel at a time,
+// and returns 0 when every command succeeded, or 1. The roles are assumed
+// one after the other since the flags hold the role being assumed.
+func runFanout(ctx context.Context, loadOpts []func(*config.LoadOptions) error, targets, args []string) int {
+	if serialNumber != "" && !sessionToken {
+		// MFA codes cannot be reused, so the roles are assumed from one MFA
+		// session of the source credentials
+		p, err := mfaSessionProvider(ctx, loadOpts)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		mfaSession = p
+	}
+	var (
+		assumeMu sync.Mutex
+		outMu    sync.Mutex
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, max(fanoutParallel, 1))
+		codes    = make([]int, len(targets))
+		stack    = readStack()
+	)
+	for i, arn := range targets {
+		wg.Add(1)
+		go func(i int, arn string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			label := fanoutLabel(arn)
+			codes[i] = runFanoutTarget(func() ([]string, func(), error) {
+				assumeMu.Lock()
+				defer assumeMu.Unlock()
+				roleArn, roleArns = arn, []string{arn}
+				role, _, err := assumeRole(ctx, loadOpts)
+				if err != nil {
+					return nil, nil, err
+				}
+				env, wipe := credentialEnv(role.Credentials)
+				env = append(env, markerKey+"="+arn)
+				env = append(env, stackEnv(append(slices.Clip(stack), stackEntry{Name: label, Arn: arn}))...)
+				return env, wipe, nil
+			}, args, &prefixWriter{mu: &outMu, w: os.Stdout, prefix: label}, &prefixWriter{mu: &outMu, w: os.Stderr, prefix: label})
+		}(i, arn)
+	}
+	wg.Wait()
+
+	var failed int
+	for i, arn := range targets {
+		if codes[i] != 0 {
+			failed++
+			log.Printf("%s: exit status %d", fanoutLabel(arn), codes[i])
+		}
+	}
+	log.Printf("%d of %d commands succeeded", len(targets)-failed, len(targets))
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runFanoutTarget assumes the role with assume and runs args with its
+// credentials, returning the exit code of the command, or 1 when it could not
+// run.
+func runFanoutTarget(assume func() ([]string, func(), error), args []string, stdout, stderr *prefixWriter) int {
+	defer stdout.Flush()
+	defer stderr.Flush()
+	env, wipe, err := assume()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer wipe()
+	for _, e := range os.Environ() {
+		k, _, _ := strings.Cut(e, "=")
+		if !slices.Contains(credentialKeys, k) && !slices.Contains(conflictingKeys, k) {
+			env = append(env, e)
+		}
+	}
+	cmd, err := newCommand(args)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	cmd.Env = wslEnv(args, env)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	stop := forwardSignals(cmd)
+	env, cmd.Env = nil, nil
+	wipe()
+	err = cmd.Wait()
+	stop()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return exitCode(cmd.ProcessState)
+}
@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// runGitCredential implements the get operation of the git credential helper
+// protocol for CodeCommit HTTPS URLs. store and erase are accepted and ignored
+// since the credentials are derived from the assumed role every time.
+//
+//	git config --global credential.helper '!aws-assume-role git-credential -role NAME'
+//	git config --global credential.UseHttpPath true
+func runGitCredential(args []string) error {
+	flag.CommandLine.Parse(args)
+	switch flag.Arg(0) {
+	case "get":
+	case "store", "erase":
+		io.Copy(io.Discard, os.Stdin)
+		return nil
+	default:
+		fmt.Fprintf(os.Stderr, "Usage: %s git-credential [FLAGS...] get|store|erase\n", os.Args[0])
+		exit(2)
+	}
+
+	attrs, err := readGitCredentialAttrs(os.Stdin)
+	if err != nil {
+		return err
+	}
+	host, path := attrs["host"], attrs["path"]
+	if attrs["protocol"] != "https" || !strings.HasPrefix(host, "git-codecommit") {
+		// not a CodeCommit URL, let other helpers answer
+		return nil
+	}
+	if path == "" {
+		return fmt.Errorf("git did not send the repository path, set credential.UseHttpPath to true")
+	}
+	parts := strings.Split(host, ".")
+	if len(parts) < 3 {
+		return fmt.Errorf("invalid CodeCommit host %q", host)
+	}
+	region := parts[1]
+
+	helperMode = true
+	ctx := context.Background()
+	loadOpts := resolveRole(ctx)
+	role, _, err := assumeRole(ctx, loadOpts)
+	if err != nil {
+		return err
+	}
+	creds := role.Credentials
+
+	username := *creds.AccessKeyId
+	if creds.SessionToken != nil {
+		username += "%" + *creds.SessionToken
+	}
+	password := codeCommitPassword(*creds.SecretAccessKey, region, host, "/"+strings.TrimPrefix(path, "/"), time.Now().UTC())
+	fmt.Printf("username=%s\npassword=%s\n", username, password)
+	return nil
+}
+
+func readGitCredentialAttrs(r io.Reader) (map[string]string, error) {
+	attrs := map[string]string{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			break
+		}
+		if k, v, ok := strings.Cut(line, "="); ok {
+			attrs[k] = v
+		}
+	}
+	return attrs, sc.Err()
+}
+
+// codeCommitPassword signs the Git request with SigV4 the same way as
+// "aws codecommit credential-helper".
+func codeCommitPassword(secretKey, region, host, path string, now time.Time) string {
+	timestamp := now.Format("20060102T150405")
+	date := now.Format("20060102")
+	canonicalRequest := "GIT\n" + path + "\n\nhost:" + host + "\n\nhost\n"
+	scope := date + "/" + region + "/codecommit/aws4_request"
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + timestamp + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "codecommit")
+	key = hmacSHA256(key, "aws4_request")
+	return timestamp + "Z" + hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
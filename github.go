@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// inGitHubActions reports if the tool runs in a GitHub Actions job.
+func inGitHubActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+func githubMask(w io.Writer, values ...string) {
+	for _, v := range values {
+		if v != "" {
+			fmt.Fprintf(w, "::add-mask::%s\n", v)
+		}
+	}
+}
+
+// appendGitHubFile appends key/value pairs to an environment file such as
+// $GITHUB_ENV or $GITHUB_OUTPUT using the multiline syntax, so values never
+// need escaping.
+func appendGitHubFile(envName string, kv []string) error {
+	name := os.Getenv(envName)
+	if name == "" {
+		return fmt.Errorf("%s is not set, not running in GitHub Actions?", envName)
+	}
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	for _, e := range kv {
+		k, v, _ := strings.Cut(e, "=")
+		delim, err := githubDelimiter()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := fmt.Fprintf(f, "%s<<%s\n%s\n%s\n", k, delim, v, delim); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// writeGitHubOutputs sets the aws-account-id and aws-expiration step outputs.
+func writeGitHubOutputs(role *sts.AssumeRoleOutput) error {
+	accountID, err := accountIDFromArn(*role.AssumedRoleUser.Arn)
+	if err != nil {
+		return err
+	}
+	return appendGitHubFile("GITHUB_OUTPUT", []string{
+		"aws-account-id=" + accountID,
+		"aws-expiration=" + role.Credentials.Expiration.Format(time.RFC3339),
+	})
+}
+
+func githubDelimiter() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "ghadelimiter_" + hex.EncodeToString(b), nil
+}
+
+// accountIDFromArn returns the account ID field of arn.
+func accountIDFromArn(arn string) (string, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return "", errors.New("invalid arn: " + arn)
+	}
+	return parts[4], nil
+}
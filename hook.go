@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/template"
+)
+
+var hookTemplates = map[string]string{
+	"sh": `{{.Name}}() {
+  if [ "$1" = "--unset" ]; then
+    eval "$(command {{.Exe}} -print-unset -shell sh)"
+    return
+  fi
+  local out
+  out="$(command {{.Exe}} -print-export -shell sh "$@")" || return
+  eval "$out"
+}
+`,
+	"fish": `function {{.Name}}
+    if test "$argv[1]" = "--unset"
+        command {{.Exe}} -print-unset -shell fish | source
+        return
+    end
+    set -l out (command {{.Exe}} -print-export -shell fish $argv); or return
+    printf '%s\n' $out | source
+end
+`,
+}
+
+func runInit(args []string) error {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	name := flags.String("name", "assume", "name of the shell function")
+	flags.Usage = func() {
+		fmt.Fprintf(
+			flags.Output(),
+			"Usage: %s init [-name NAME] bash|zsh|fish\n\n"+
+				"  eval \"$(aws-assume-role init bash)\"\n"+
+				"  aws-assume-role init fish | source\n\n",
+			os.Args[0],
+		)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		exit(2)
+	}
+
+	syntax, err := shellSyntax(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if _, ok := hookTemplates[syntax]; !ok {
+		return fmt.Errorf("init does not support %s, use -print-export", flags.Arg(0))
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	quote := shQuote
+	if syntax == "fish" {
+		quote = fishQuote
+	}
+	t := template.Must(template.New(syntax).Parse(hookTemplates[syntax]))
+	return t.Execute(os.Stdout, map[string]string{
+		"Name": *name,
+		"Exe":  quote(exe),
+	})
+}
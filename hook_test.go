@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestHookAssumeTwice runs the shell function of init twice in a row, the
+// second one from the shell holding the credentials of the first.
+func TestHookAssumeTwice(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sts := &fakeSTS{}
+	srv := httptest.NewServer(sts)
+	defer srv.Close()
+
+	script := `eval "$("$AAR" init sh)" || exit 1
+flags="-endpoint-url $AWS_ASSUME_ROLE_TEST_STS -rate-limit 0"
+assume -role-arn arn:aws:iam::123456789012:role/First $flags || exit 1
+echo "$AWS_ASSUME_ROLE_ARN $AWS_ACCESS_KEY_ID"
+assume -role-arn arn:aws:iam::123456789012:role/Second $flags || exit 1
+echo "$AWS_ASSUME_ROLE_ARN $AWS_ACCESS_KEY_ID"
+`
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Env = append(toolEnv(t, srv), "AAR="+exe)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, out)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	want := []string{
+		"arn:aws:iam::123456789012:role/First ASIAFIRST",
+		"arn:aws:iam::123456789012:role/Second ASIASECOND",
+	}
+	if !slices.Equal(lines, want) {
+		t.Errorf("output = %q, want %q", lines, want)
+	}
+	// the second role is assumed from the original credentials
+	if !slices.Equal(sts.signers, []string{"AKIASOURCE", "AKIASOURCE"}) {
+		t.Errorf("AssumeRole signed by %q", sts.signers)
+	}
+}
@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// repeatedValue is a flag.Value that can be given several times. The last
+// value is also stored in *last when set, so code unaware of repetition keeps
+// working.
+type repeatedValue struct {
+	values *[]string
+	last   *string
+	sep    string
+}
+
+func (v *repeatedValue) String() string {
+	if v.values == nil {
+		return ""
+	}
+	return strings.Join(*v.values, ",")
+}
+
+func (v *repeatedValue) Set(s string) error {
+	parts := []string{s}
+	if v.sep != "" {
+		parts = strings.Split(s, v.sep)
+	}
+	for _, p := range parts {
+		*v.values = append(*v.values, strings.TrimSpace(p))
+	}
+	if v.last != nil {
+		*v.last = (*v.values)[len(*v.values)-1]
+	}
+	return nil
+}
+
+// hopValue returns the value for the i-th role of the chain when a value is
+// given for each role, or def.
+func hopValue(values []string, i int, def string) string {
+	if len(values) == len(roleArns) {
+		return values[i]
+	}
+	return def
+}
+
+// assumeHops assumes the intermediate roles of the chain given with several
+// -role-arn in order, and returns cfg with the credentials of the last one.
+func assumeHops(ctx context.Context, cfg aws.Config) (aws.Config, error) {
+	stsClient := sts.NewFromConfig(cfg, func(o *sts.Options) {
+		o.Retryer = aws.NopRetryer{}
+	})
+	creds, err := roleProvider(stsClient, 0).AssumeHops(ctx)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Credentials = creds
+	return cfg, nil
+}
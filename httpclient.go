@@ -0,0 +1,30 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+// sharedHTTPClient is used by every config loaded by the tool, so all STS, IAM
+// and other calls of a process share one connection pool instead of dialing
+// and handshaking per client.
+var sharedHTTPClient = sync.OnceValue(func() *awshttp.BuildableClient {
+	return awshttp.NewBuildableClient().
+		WithDialerOptions(func(d *net.Dialer) {
+			d.Timeout = 10 * time.Second
+			d.KeepAlive = 30 * time.Second
+		}).
+		WithTransportOptions(func(t *http.Transport) {
+			t.ForceAttemptHTTP2 = true
+			t.MaxIdleConns = 100
+			t.MaxIdleConnsPerHost = 32
+			t.IdleConnTimeout = 90 * time.Second
+			t.TLSHandshakeTimeout = 10 * time.Second
+			t.ResponseHeaderTimeout = 30 * time.Second
+		})
+})
@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// identityClaims are tried in order for the name of the human behind an OIDC
+// token.
+var identityClaims = []string{"email", "preferred_username", "upn", "sub"}
+
+var (
+	sourceIdentityInvalid = regexp.MustCompile(`[^\w+=,.@-]`)
+	tagValueInvalid       = regexp.MustCompile(`[^\p{L}\p{Z}\p{N}_.:/=+@-]`)
+)
+
+// federatedIdentity returns the identity of the human behind the source
+// credentials and the claims of the OIDC token they come from, if any. For
+// IAM Identity Center the identity is the session name of the
+// AWSReservedSSO_* role, which is the user name.
+func federatedIdentity(ctx context.Context, cfg aws.Config) (string, map[string]any, error) {
+	name := webIdentityTokenFile
+	if name == "" {
+		name = os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	}
+	if name != "" {
+		claims, err := jwtClaims(name)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, c := range identityClaims {
+			if v, ok := claims[c].(string); ok && v != "" {
+				return v, claims, nil
+			}
+		}
+		return "", nil, fmt.Errorf("%s: no identity claim (%s)", name, strings.Join(identityClaims, ", "))
+	}
+
+	out, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", nil, err
+	}
+	// arn:aws:sts::123456789012:assumed-role/AWSReservedSSO_Admin_0123456789abcdef/alice@example.com
+	parts := strings.SplitN(*out.Arn, ":", 6)
+	if kind, rest, _ := strings.Cut(parts[len(parts)-1], "/"); kind == "assumed-role" {
+		role, session, _ := strings.Cut(rest, "/")
+		if strings.HasPrefix(role, "AWSReservedSSO_") {
+			return session, nil, nil
+		}
+	}
+	return "", nil, errors.New("source credentials are not federated through IAM Identity Center or OIDC: " + *out.Arn)
+}
+
+func jwtClaims(name string) (map[string]any, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(strings.TrimSpace(string(b)), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%s: not a JWT", name)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	claims := map[string]any{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return claims, nil
+}
+
+// applyFederatedIdentity sets SourceIdentity (unless given) and the Principal
+// session tag from the federated identity, plus tags mapped from OIDC claims
+// by -identity-tags. Explicit tags take precedence.
+func applyFederatedIdentity(ctx context.Context, cfg aws.Config) error {
+	identity, claims, err := federatedIdentity(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if sourceIdentity == "" {
+		sourceIdentity = truncate(sourceIdentityInvalid.ReplaceAllString(identity, "_"), 64)
+	}
+	tags := map[string]string{"Principal": identity}
+	for _, kv := range splitList(identityTags) {
+		key, claim, found := strings.Cut(kv, "=")
+		if !found {
+			return fmt.Errorf("invalid identity tag %q, must be TAG=claim", kv)
+		}
+		if v, ok := claims[claim]; ok {
+			tags[key] = fmt.Sprint(v)
+		}
+	}
+	// in a stable order, since the tags are part of the cache key
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if hasTag(sessionTags, key) {
+			continue
+		}
+		sessionTags = append(sessionTags, types.Tag{Key: aws.String(key), Value: aws.String(truncate(tagValueInvalid.ReplaceAllString(tags[key], "_"), 256))})
+	}
+	return nil
+}
+
+func hasTag(tags []types.Tag, key string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(*t.Key, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// grantedKeys maps keys of Granted profiles to the keys of the tool config.
+var grantedKeys = [][2]string{
+	{"role_arn", "role_arn"},
+	{"external_id", "external_id"},
+	{"mfa_serial", "mfa_serial"},
+	{"role_session_name", "role_session_name"},
+	{"source_profile", "source_profile"},
+	{"region", "region"},
+}
+
+func runImport(args []string) error {
+	if len(args) == 0 || args[0] != "granted" {
+		fmt.Fprintf(os.Stderr, "Usage: %s import granted [FLAGS...] [REGISTRY|AWS CONFIG]...\n", os.Args[0])
+		exit(2)
+	}
+
+	flags := flag.NewFlagSet("import granted", flag.ExitOnError)
+	prefix := flags.String("prefix", "", "prefix of the imported role names")
+	dryRun := flags.Bool("dry-run", false, "print the updated config instead of writing it")
+	flags.Usage = func() {
+		fmt.Fprintf(
+			flags.Output(),
+			"Usage: %s import granted [FLAGS...] [REGISTRY|AWS CONFIG]...\n\n"+
+				"Imports the profiles of Granted profile registries (directories with granted.yml)\n"+
+				"or of AWS config files generated by Granted into the tool config.\n\n",
+			os.Args[0],
+		)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args[1:])
+	if flags.NArg() == 0 {
+		flags.Usage()
+		exit(2)
+	}
+
+	var files []string
+	for _, p := range flags.Args() {
+		f, err := grantedConfigFiles(p)
+		if err != nil {
+			return err
+		}
+		files = append(files, f...)
+	}
+
+	name, err := toolConfigFile()
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	content := string(b)
+
+	var imported int
+	for _, f := range files {
+		sections, err := readINIFile(f)
+		if err != nil {
+			return err
+		}
+		for _, s := range sections {
+			profile, ok := strings.CutPrefix(s.Name, "profile ")
+			if !ok && s.Name != "default" {
+				continue
+			}
+			if s.Name == "default" {
+				profile = s.Name
+			}
+			if s.get("role_arn") == "" {
+				if s.get("granted_sso_start_url") != "" || s.get("sso_start_url") != "" {
+					log.Printf("%s: skipping SSO profile %s", f, profile)
+				}
+				continue
+			}
+			var kv [][2]string
+			for _, k := range grantedKeys {
+				if v := s.get(k[0]); v != "" {
+					kv = append(kv, [2]string{k[1], v})
+				}
+			}
+			if v := s.get("duration_seconds"); v != "" {
+				kv = append(kv, [2]string{"duration", v + "s"})
+			}
+			content = updateINISection(content, "role "+*prefix+profile, []string{"# imported from " + f}, kv)
+			imported++
+		}
+	}
+
+	if *dryRun {
+		fmt.Print(content)
+		return nil
+	}
+	if content == string(b) {
+		log.Printf("%s is up to date", name)
+		return nil
+	}
+	if err := writeFileAtomic(name, []byte(content)); err != nil {
+		return err
+	}
+	log.Printf("imported %d roles into %s", imported, name)
+	return nil
+}
+
+// grantedConfigFiles returns the AWS config files referenced by the granted.yml
+// of the registry at p, or p itself when it is not a registry.
+func grantedConfigFiles(p string) ([]string, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	dir, manifest := p, filepath.Join(p, "granted.yml")
+	if !fi.IsDir() {
+		if filepath.Base(p) != "granted.yml" {
+			return []string{p}, nil
+		}
+		dir, manifest = filepath.Dir(p), p
+	}
+	b, err := os.ReadFile(manifest)
+	if err != nil {
+		return nil, err
+	}
+	var registry struct {
+		AwsConfig []string `yaml:"awsConfig"`
+	}
+	if err := yaml.Unmarshal(b, &registry); err != nil {
+		return nil, fmt.Errorf("%s: %w", manifest, err)
+	}
+	if len(registry.AwsConfig) == 0 {
+		return nil, fmt.Errorf("%s: awsConfig is empty", manifest)
+	}
+	files := make([]string, 0, len(registry.AwsConfig))
+	for _, f := range registry.AwsConfig {
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(dir, f)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
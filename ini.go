@@ -0,0 +1,163 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+type iniSection struct {
+	Name   string
+	Keys   []string
+	Values map[string]string
+}
+
+func (s *iniSection) get(key string) string {
+	return s.Values[key]
+}
+
+func parseINI(r io.Reader) ([]*iniSection, error) {
+	var (
+		sections []*iniSection
+		current  *iniSection
+	)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		raw := sc.Text()
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if name, ok := iniHeader(line); ok {
+			current = &iniSection{
+				Name:   name,
+				Values: map[string]string{},
+			}
+			sections = append(sections, current)
+			continue
+		}
+		// nested values such as "s3 =\n  max_concurrent_requests = 10" are ignored
+		if current == nil || raw[0] == ' ' || raw[0] == '\t' {
+			continue
+		}
+		k, v, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		k = strings.TrimSpace(k)
+		if _, ok := current.Values[k]; !ok {
+			current.Keys = append(current.Keys, k)
+		}
+		current.Values[k] = strings.TrimSpace(v)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return sections, nil
+}
+
+func readINIFile(name string) ([]*iniSection, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseINI(f)
+}
+
+func iniHeader(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+		return "", false
+	}
+	return strings.Join(strings.Fields(line[1:len(line)-1]), " "), true
+}
+
+// iniSectionLines returns the raw lines of the section name in content.
+func iniSectionLines(content, name string) ([]string, bool) {
+	var (
+		lines []string
+		in    bool
+	)
+	for _, l := range strings.Split(content, "\n") {
+		if n, ok := iniHeader(l); ok {
+			if in {
+				break
+			}
+			in = n == name
+			continue
+		}
+		if in {
+			lines = append(lines, l)
+		}
+	}
+	return lines, in
+}
+
+// updateINISection sets keys of the section name in content, preserving
+// comments, unknown keys and other sections. If the section does not exist,
+// it is appended with header lines (such as comments) following the header.
+func updateINISection(content, name string, header []string, kv [][2]string) string {
+	lines := strings.Split(content, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	start := -1
+	for i, l := range lines {
+		if n, ok := iniHeader(l); ok && n == name {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "["+name+"]")
+		lines = append(lines, header...)
+		for _, p := range kv {
+			lines = append(lines, p[0]+" = "+p[1])
+		}
+		return strings.Join(lines, "\n") + "\n"
+	}
+
+	end := len(lines)
+	for i := start + 1; i < len(lines); i++ {
+		if _, ok := iniHeader(lines[i]); ok {
+			end = i
+			break
+		}
+	}
+	last := start
+	for i := start + 1; i < end; i++ {
+		if strings.TrimSpace(lines[i]) != "" {
+			last = i
+		}
+	}
+
+	var missing []string
+	for _, p := range kv {
+		found := false
+		for i := start + 1; i < end; i++ {
+			l := lines[i]
+			if l == "" || l[0] == ' ' || l[0] == '\t' {
+				continue
+			}
+			if k, _, ok := strings.Cut(l, "="); ok && strings.TrimSpace(k) == p[0] {
+				lines[i] = p[0] + " = " + p[1]
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, p[0]+" = "+p[1])
+		}
+	}
+	updated := append([]string{}, lines[:last+1]...)
+	updated = append(updated, missing...)
+	updated = append(updated, lines[last+1:]...)
+	return strings.Join(updated, "\n") + "\n"
+}
@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseINI(t *testing.T) {
+	const config = `# comment
+[default]
+region = us-east-1
+
+[profile  dev]
+; comment
+role_arn=arn:aws:iam::123456789012:role/Dev
+source_profile = default
+s3 =
+  max_concurrent_requests = 10
+region = eu-west-1
+region = ap-northeast-1
+`
+	sections, err := parseINI(strings.NewReader(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*iniSection{
+		{Name: "default", Keys: []string{"region"}, Values: map[string]string{"region": "us-east-1"}},
+		{
+			Name: "profile dev",
+			Keys: []string{"role_arn", "source_profile", "s3", "region"},
+			Values: map[string]string{
+				"role_arn":       "arn:aws:iam::123456789012:role/Dev",
+				"source_profile": "default",
+				"s3":             "",
+				"region":         "ap-northeast-1",
+			},
+		},
+	}
+	if !reflect.DeepEqual(sections, want) {
+		t.Errorf("parseINI() = %+v, want %+v", sections, want)
+	}
+}
+
+func TestUpdateINISection(t *testing.T) {
+	const config = `[default]
+region = us-east-1
+
+[profile dev]
+# managed by aws-assume-role
+credential_process = old
+s3 =
+  credential_process = nested
+output = json
+
+[profile other]
+region = eu-west-1
+`
+	tests := []struct {
+		name    string
+		content string
+		section string
+		kv      [][2]string
+		want    string
+	}{
+		{
+			name:    "update and add keys",
+			content: config,
+			section: "profile dev",
+			kv:      [][2]string{{"credential_process", "new"}, {"region", "ap-northeast-1"}},
+			want: `[default]
+region = us-east-1
+
+[profile dev]
+# managed by aws-assume-role
+credential_process = new
+s3 =
+  credential_process = nested
+output = json
+region = ap-northeast-1
+
+[profile other]
+region = eu-west-1
+`,
+		},
+		{
+			name:    "append section",
+			content: strings.TrimSuffix(config, "\n"),
+			section: "profile new",
+			kv:      [][2]string{{"credential_process", "new"}},
+			want: config + `
+[profile new]
+# managed by aws-assume-role
+credential_process = new
+`,
+		},
+		{
+			name:    "empty file",
+			section: "default",
+			kv:      [][2]string{{"region", "us-east-1"}},
+			want: `[default]
+# managed by aws-assume-role
+region = us-east-1
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := updateINISection(tt.content, tt.section, []string{integrateMarker}, tt.kv)
+			if got != tt.want {
+				t.Errorf("updateINISection() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// isInit reports whether the tool runs as PID 1, typically as the ENTRYPOINT
+// of a container.
+func isInit() bool {
+	return os.Getpid() == 1
+}
+
+// runAsInit starts cmd and acts as a minimal init until it exits: every signal
+// (including the STOPSIGNAL of the container) is forwarded to the child, and
+// orphaned processes re-parented to PID 1 are reaped. It returns the exit code
+// of the child, 128+n when it was killed by signal n.
+func runAsInit(cmd *exec.Cmd, started func()) int {
+	sigs := make(chan os.Signal, 64)
+	signal.Notify(sigs)
+	if err := cmd.Start(); err != nil {
+		log.Print(err)
+		return 1
+	}
+	started()
+	pid := cmd.Process.Pid
+
+	for sig := range sigs {
+		switch sig {
+		case syscall.SIGCHLD:
+			for {
+				var ws syscall.WaitStatus
+				wpid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+				if err != nil || wpid <= 0 {
+					break
+				}
+				if wpid != pid {
+					continue
+				}
+				if ws.Signaled() {
+					return 128 + int(ws.Signal())
+				}
+				return ws.ExitStatus()
+			}
+		case syscall.SIGURG:
+			// used by the Go runtime for goroutine preemption
+		default:
+			if s, ok := sig.(syscall.Signal); ok {
+				syscall.Kill(pid, s)
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,14 @@
+// SPDX-License-Identifier: MIT
+//go:build !linux
+
+package main
+
+import "os/exec"
+
+func isInit() bool {
+	return false
+}
+
+func runAsInit(cmd *exec.Cmd, started func()) int {
+	panic("unreachable")
+}
@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// integrateMarker identifies sections of ~/.aws/config written by integrate,
+// which are the only ones it is allowed to overwrite.
+const integrateMarker = "# managed by aws-assume-role"
+
+func runIntegrate(args []string) error {
+	if len(args) == 0 || args[0] != "aws-cli" {
+		fmt.Fprintf(os.Stderr, "Usage: %s integrate aws-cli [FLAGS...] [NAMES...]\n", os.Args[0])
+		exit(2)
+	}
+
+	flags := flag.NewFlagSet("integrate aws-cli", flag.ExitOnError)
+	all := flags.Bool("all", false, "integrate all roles of the tool config")
+	prefix := flags.String("prefix", "", "prefix of the profile names")
+	configFile := flags.String("config-file", "", "AWS config file (default ~/.aws/config)")
+	dryRun := flags.Bool("dry-run", false, "print the updated config instead of writing it")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s integrate aws-cli [FLAGS...] [NAMES...]\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args[1:])
+
+	c, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	var entries []*catalogEntry
+	if *all {
+		for _, e := range c.entries {
+			if e.Source == sourceToolConfig {
+				entries = append(entries, e)
+			}
+		}
+	}
+	for _, name := range flags.Args() {
+		e, ok := c.lookup(name)
+		if !ok {
+			return fmt.Errorf("role %q is not found in the catalog", name)
+		}
+		if !slices.Contains(entries, e) {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == 0 {
+		flags.Usage()
+		exit(2)
+	}
+
+	name := *configFile
+	if name == "" {
+		if name, err = awsConfigFile(); err != nil {
+			return err
+		}
+	}
+	b, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	original := string(b)
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	content := original
+	for _, e := range entries {
+		profile := *prefix + e.Name
+		section := "profile " + profile
+		if profile == "default" {
+			section = profile
+		}
+		if lines, ok := iniSectionLines(content, section); ok && !slices.Contains(lines, integrateMarker) {
+			return fmt.Errorf("%s: [%s] is not managed by aws-assume-role, use -prefix", name, section)
+		}
+		kv := [][2]string{
+			{"credential_process", fmt.Sprintf("%s -role %s -output json", credentialProcessArg(exe), credentialProcessArg(e.Name))},
+		}
+		if e.Region != "" {
+			kv = append(kv, [2]string{"region", e.Region})
+		}
+		content = updateINISection(content, section, []string{integrateMarker}, kv)
+	}
+
+	if *dryRun {
+		fmt.Print(content)
+		return nil
+	}
+	if content == original {
+		log.Printf("%s is up to date", name)
+		return nil
+	}
+	if original != "" {
+		backup := name + "." + time.Now().Format("20060102150405") + ".bak"
+		if err := writeFileAtomic(backup, b); err != nil {
+			return err
+		}
+		log.Printf("backed up %s to %s", name, backup)
+	}
+	if err := writeFileAtomic(name, []byte(content)); err != nil {
+		return err
+	}
+	log.Printf("updated %d profiles in %s", len(entries), name)
+	return nil
+}
+
+// isManagedProfile reports whether the profile of the AWS config was written by
+// integrate. Loading source credentials from such a profile would invoke this
+// tool recursively through credential_process.
+func isManagedProfile(profile string) bool {
+	name, err := awsConfigFile()
+	if err != nil {
+		return false
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return false
+	}
+	section := "profile " + profile
+	if profile == "default" {
+		section = profile
+	}
+	lines, ok := iniSectionLines(string(b), section)
+	return ok && slices.Contains(lines, integrateMarker)
+}
+
+// credentialProcessPlain are the arguments of credential_process that need no
+// quoting, backslashes being the separators of paths on Windows.
+var credentialProcessPlain = regexp.MustCompile(`^[A-Za-z0-9._/:@+=,\\-]+$`)
+
+// credentialProcessArg quotes s for credential_process, which SDKs run with
+// the shell (sh -c or cmd.exe /C) or split like it, so paths with spaces or
+// quotes and names with metacharacters stay one argument.
+func credentialProcessArg(s string) string {
+	plain := credentialProcessPlain.MatchString(s)
+	if runtime.GOOS == "windows" {
+		if plain {
+			return s
+		}
+		return `"` + s + `"`
+	}
+	if plain && !strings.Contains(s, `\`) {
+		return s
+	}
+	return shQuote(s)
+}
@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+const javaToolOptionsKey = "JAVA_TOOL_OPTIONS"
+
+// javaProperties returns the system properties read by the SystemProperty
+// credentials providers of the AWS SDKs for Java.
+func javaProperties(creds *types.Credentials) []string {
+	return []string{
+		"-Daws.accessKeyId=" + *creds.AccessKeyId,
+		"-Daws.secretAccessKey=" + *creds.SecretAccessKey,
+		"-Daws.sessionToken=" + *creds.SessionToken,
+	}
+}
+
+// javaToolOptionsEnv returns JAVA_TOOL_OPTIONS with the system properties
+// appended to its current value, backed by a secret.
+func javaToolOptionsEnv(creds *types.Credentials) (string, func()) {
+	opts := javaProperties(creds)
+	if v := os.Getenv(javaToolOptionsKey); v != "" {
+		opts = append([]string{v}, opts...)
+	}
+	s := newSecret(javaToolOptionsKey+"=", strings.Join(opts, " "))
+	return s.unsafeString(), atCleanup(s.wipe)
+}
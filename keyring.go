@@ -0,0 +1,241 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// keyringService is the service of the items of the tool in the OS keyring.
+// Items are named source/NAME for source credentials and session/HASH for
+// cached sessions.
+const keyringService = "aws-assume-role"
+
+var errKeyringNotFound = errors.New("not found in the keyring")
+
+var keyringNamePattern = regexp.MustCompile(`^[A-Za-z0-9._@+-]+$`)
+
+type keyringSourceItem struct {
+	AccessKeyId     string
+	SecretAccessKey string
+}
+
+// useKeyring reports if cached sessions are stored in the OS keyring. Sessions
+// of keyring source credentials never go to plain files.
+func useKeyring() bool {
+	return keyringMode || keyringSource != ""
+}
+
+func keyringSessionKey(file string) string {
+	return "session/" + strings.TrimSuffix(filepath.Base(file), ".json")
+}
+
+// keyringOptions replaces the default credential chain with the source
+// credentials of -keyring-source.
+func keyringOptions() []func(*config.LoadOptions) error {
+	if keyringSource == "" {
+		return nil
+	}
+	return []func(*config.LoadOptions) error{
+		config.WithCredentialsProvider(aws.NewCredentialsCache(keyringCredentials{name: keyringSource})),
+	}
+}
+
+// keyringCredentials provides the source credentials stored by keyring add.
+type keyringCredentials struct {
+	name string
+}
+
+func (p keyringCredentials) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	b, err := keyringGet("source/" + p.name)
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf("keyring source %s: %w", p.name, err)
+	}
+	defer clear(b)
+	var item keyringSourceItem
+	if err := json.Unmarshal(b, &item); err != nil {
+		return aws.Credentials{}, fmt.Errorf("keyring source %s: %w", p.name, err)
+	}
+	return aws.Credentials{
+		AccessKeyID:     item.AccessKeyId,
+		SecretAccessKey: item.SecretAccessKey,
+		Source:          "keyring",
+	}, nil
+}
+
+func runKeyring(args []string) error {
+	usage := func() {
+		fmt.Fprintf(
+			os.Stderr,
+			"Usage: %s keyring add [-from-profile PROFILE] NAME | remove NAME... | list\n\n"+
+				"  aws-assume-role keyring add -from-profile default work\n"+
+				"  aws-assume-role -keyring-source work -role prod-admin -- aws s3 ls\n",
+			os.Args[0],
+		)
+		exit(2)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+	switch args[0] {
+	case "add":
+		return keyringAdd(args[1:])
+	case "remove":
+		if len(args) == 1 {
+			usage()
+		}
+		return keyringRemove(args[1:])
+	case "list":
+		return printKeyring(os.Stdout)
+	}
+	usage()
+	return nil
+}
+
+// keyringAdd stores the long-term keys of an IAM user as keyring source
+// credentials, read from a profile of the shared credentials file, the
+// terminal or two lines of stdin.
+func keyringAdd(args []string) error {
+	flags := flag.NewFlagSet("keyring add", flag.ExitOnError)
+	fromProfile := flags.String("from-profile", "", "copy the keys of the `profile` of the shared credentials file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s keyring add [-from-profile PROFILE] NAME\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	name := flags.Arg(0)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		exit(2)
+	}
+	if !keyringNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid name %q, must consist of letters, digits and ._@+-", name)
+	}
+
+	var item keyringSourceItem
+	switch {
+	case *fromProfile != "":
+		file, err := awsCredentialsFile()
+		if err != nil {
+			return err
+		}
+		sections, err := readINIFile(file)
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(sections, func(s *iniSection) bool { return s.Name == *fromProfile })
+		if i < 0 {
+			return fmt.Errorf("profile %s is not found in %s", *fromProfile, file)
+		}
+		item.AccessKeyId = sections[i].get("aws_access_key_id")
+		item.SecretAccessKey = sections[i].get("aws_secret_access_key")
+		if sections[i].get("aws_session_token") != "" {
+			return fmt.Errorf("profile %s holds temporary credentials, only long-term keys belong to the keyring", *fromProfile)
+		}
+	case isTerminal(os.Stdin):
+		var err error
+		if item.AccessKeyId, err = promptTTY(context.Background(), "Access key ID: "); err != nil {
+			return err
+		}
+		if item.SecretAccessKey, err = promptTTYSecret(context.Background(), "Secret access key: "); err != nil {
+			return err
+		}
+	default:
+		sc := bufio.NewScanner(os.Stdin)
+		for _, v := range []*string{&item.AccessKeyId, &item.SecretAccessKey} {
+			if sc.Scan() {
+				*v = strings.TrimSpace(sc.Text())
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return err
+		}
+	}
+	if item.AccessKeyId == "" || item.SecretAccessKey == "" {
+		return errors.New("both the access key ID and the secret access key are required")
+	}
+
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	defer clear(b)
+	if err := keyringSet("source/"+name, keyringService+" source credentials "+name, b); err != nil {
+		return err
+	}
+	log.Printf("stored the keys of %s in the keyring as %s, use them with -keyring-source %s", item.AccessKeyId, name, name)
+	if *fromProfile != "" {
+		log.Printf("remove profile %s from the shared credentials file once the keyring works for you", *fromProfile)
+	}
+	return nil
+}
+
+// keyringRemove removes items by their names as printed by keyring list, where
+// bare names are source credentials.
+func keyringRemove(names []string) error {
+	for _, name := range names {
+		if !strings.Contains(name, "/") {
+			name = "source/" + name
+		}
+		if _, err := keyringGet(name); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := keyringDelete(name); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		log.Printf("removed %s from the keyring", name)
+	}
+	return nil
+}
+
+func printKeyring(w io.Writer) error {
+	keys, err := keyringList()
+	if err != nil {
+		return err
+	}
+	slices.Sort(keys)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tDETAILS")
+	for _, k := range keys {
+		b, err := keyringGet(k)
+		if err != nil {
+			fmt.Fprintf(tw, "%s\t%v\n", k, err)
+			continue
+		}
+		var details string
+		switch {
+		case strings.HasPrefix(k, "source/"):
+			var item keyringSourceItem
+			if json.Unmarshal(b, &item) == nil {
+				details = "access key " + item.AccessKeyId
+			}
+		case strings.HasPrefix(k, "session/"):
+			var s cachedSession
+			if json.Unmarshal(b, &s) == nil && s.AssumedRoleUser != nil && s.Credentials != nil {
+				details = aws.ToString(s.AssumedRoleUser.Arn) + " until " + s.Credentials.Expiration.Local().Format(time.DateTime)
+				if time.Now().After(*s.Credentials.Expiration) {
+					details += " (expired)"
+				}
+			}
+		}
+		clear(b)
+		fmt.Fprintf(tw, "%s\t%s\n", k, details)
+	}
+	return tw.Flush()
+}
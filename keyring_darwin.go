@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: MIT
+//go:build darwin
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+// The login keychain is used through the security command. Secrets are given
+// to it on stdin in its interactive mode, since arguments are visible to other
+// users of the machine.
+
+// errSecItemNotFound is the exit status of security for missing items.
+const errSecItemNotFound = 44
+
+func keyringGet(key string) ([]byte, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", keyringService, "-a", key, "-w").Output()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == errSecItemNotFound:
+		return nil, errKeyringNotFound
+	case err != nil:
+		return nil, securityError(err)
+	}
+	return bytes.TrimSuffix(out, []byte("\n")), nil
+}
+
+func keyringSet(key, label string, data []byte) error {
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = bytes.NewBufferString(fmt.Sprintf(
+		"add-generic-password -U -s %s -a %s -l %s -X %s\n",
+		strconv.Quote(keyringService), strconv.Quote(key), strconv.Quote(label), hex.EncodeToString(data),
+	))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return securityError(err)
+	}
+	// the interactive mode does not fail with the command
+	if b, err := keyringGet(key); err != nil || !bytes.Equal(b, data) {
+		return fmt.Errorf("security: cannot add %s to the keychain: %s", key, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func keyringDelete(key string) error {
+	_, err := exec.Command("security", "delete-generic-password", "-s", keyringService, "-a", key).Output()
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == errSecItemNotFound) {
+		return securityError(err)
+	}
+	return nil
+}
+
+var (
+	keychainItemPattern    = regexp.MustCompile(`(?m)^class: `)
+	keychainServicePattern = regexp.MustCompile(`"svce"<blob>="(.*)"`)
+	keychainAccountPattern = regexp.MustCompile(`"acct"<blob>="(.*)"`)
+)
+
+func keyringList() ([]string, error) {
+	// without -d the dump has the attributes of the items but no secrets
+	out, err := exec.Command("security", "dump-keychain").Output()
+	if err != nil {
+		return nil, securityError(err)
+	}
+	var keys []string
+	for _, item := range keychainItemPattern.Split(string(out), -1) {
+		s := keychainServicePattern.FindStringSubmatch(item)
+		a := keychainAccountPattern.FindStringSubmatch(item)
+		if s != nil && a != nil && s[1] == keyringService {
+			keys = append(keys, a[1])
+		}
+	}
+	return keys, nil
+}
+
+func securityError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("security: %s", bytes.TrimSpace(exitErr.Stderr))
+	}
+	return fmt.Errorf("security: %w", err)
+}
@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: MIT
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The Secret Service (GNOME Keyring, KWallet) is used through secret-tool of
+// libsecret, which keeps the secrets out of the command line.
+
+func keyringGet(key string) ([]byte, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", keyringService, "account", key).Output()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr) && len(out) == 0 && len(exitErr.Stderr) == 0:
+		return nil, errKeyringNotFound
+	case err != nil:
+		return nil, secretToolError(err)
+	}
+	return bytes.TrimSuffix(out, []byte("\n")), nil
+}
+
+func keyringSet(key, label string, data []byte) error {
+	cmd := exec.Command("secret-tool", "store", "--label="+label, "service", keyringService, "account", key)
+	cmd.Stdin = bytes.NewReader(data)
+	if _, err := cmd.Output(); err != nil {
+		return secretToolError(err)
+	}
+	return nil
+}
+
+func keyringDelete(key string) error {
+	if _, err := exec.Command("secret-tool", "clear", "service", keyringService, "account", key).Output(); err != nil {
+		return secretToolError(err)
+	}
+	return nil
+}
+
+func keyringList() ([]string, error) {
+	// secret-tool prints the attributes of the items along with their secrets
+	out, err := exec.Command("secret-tool", "search", "--all", "service", keyringService).CombinedOutput()
+	var keys []string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		if k, ok := strings.CutPrefix(sc.Text(), "attribute.account = "); ok {
+			keys = append(keys, k)
+		}
+	}
+	clear(out)
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && len(keys) == 0) {
+		return nil, secretToolError(err)
+	}
+	return keys, nil
+}
+
+func secretToolError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("secret-tool: %s", bytes.TrimSpace(exitErr.Stderr))
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("the keyring requires secret-tool of libsecret: %w", err)
+	}
+	return fmt.Errorf("secret-tool: %w", err)
+}
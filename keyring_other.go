@@ -0,0 +1,25 @@
+// SPDX-License-Identifier: MIT
+//go:build !linux && !darwin && !windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func keyringGet(key string) ([]byte, error) {
+	return nil, fmt.Errorf("the keyring is not supported on %s", runtime.GOOS)
+}
+
+func keyringSet(key, label string, data []byte) error {
+	return fmt.Errorf("the keyring is not supported on %s", runtime.GOOS)
+}
+
+func keyringDelete(key string) error {
+	return fmt.Errorf("the keyring is not supported on %s", runtime.GOOS)
+}
+
+func keyringList() ([]string, error) {
+	return nil, fmt.Errorf("the keyring is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: MIT
+//go:build windows
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modadvapi32        = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW      = modadvapi32.NewProc("CredReadW")
+	procCredWriteW     = modadvapi32.NewProc("CredWriteW")
+	procCredDeleteW    = modadvapi32.NewProc("CredDeleteW")
+	procCredEnumerateW = modadvapi32.NewProc("CredEnumerateW")
+	procCredFree       = modadvapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	// credMaxBlobSize is CRED_MAX_CREDENTIAL_BLOB_SIZE. Larger secrets, such as
+	// sessions with many tags, are split into the items TARGET, TARGET#1, ...
+	credMaxBlobSize = 5 * 512
+)
+
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// credTarget is the target name of the part-th item of key in the Windows
+// Credential Manager.
+func credTarget(key string, part int) string {
+	t := keyringService + ":" + key
+	if part > 0 {
+		t += "#" + strconv.Itoa(part)
+	}
+	return t
+}
+
+func credRead(target string) ([]byte, error) {
+	name, err := syscall.UTF16PtrFromString(target)
+	if err != nil {
+		return nil, err
+	}
+	var c *credential
+	r, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(name)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&c)))
+	if r == 0 {
+		if err == syscall.ERROR_NOT_FOUND {
+			return nil, errKeyringNotFound
+		}
+		return nil, err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(c)))
+	if c.CredentialBlobSize == 0 {
+		return nil, nil
+	}
+	return append([]byte(nil), unsafe.Slice(c.CredentialBlob, c.CredentialBlobSize)...), nil
+}
+
+func credDelete(target string) error {
+	name, err := syscall.UTF16PtrFromString(target)
+	if err != nil {
+		return err
+	}
+	if r, _, err := procCredDeleteW.Call(uintptr(unsafe.Pointer(name)), credTypeGeneric, 0); r == 0 {
+		if err == syscall.ERROR_NOT_FOUND {
+			return errKeyringNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func keyringGet(key string) ([]byte, error) {
+	data, err := credRead(credTarget(key, 0))
+	if err != nil {
+		return nil, err
+	}
+	for part := 1; ; part++ {
+		b, err := credRead(credTarget(key, part))
+		switch {
+		case err == errKeyringNotFound:
+			return data, nil
+		case err != nil:
+			clear(data)
+			return nil, err
+		}
+		data = append(data, b...)
+		clear(b)
+	}
+}
+
+func keyringSet(key, label string, data []byte) error {
+	user, err := syscall.UTF16PtrFromString(key)
+	if err != nil {
+		return err
+	}
+	comment, err := syscall.UTF16PtrFromString(label)
+	if err != nil {
+		return err
+	}
+	part := 0
+	for ; part == 0 || len(data) > 0; part++ {
+		chunk := data[:min(len(data), credMaxBlobSize)]
+		data = data[len(chunk):]
+		target, err := syscall.UTF16PtrFromString(credTarget(key, part))
+		if err != nil {
+			return err
+		}
+		c := credential{
+			Type:               credTypeGeneric,
+			TargetName:         target,
+			Comment:            comment,
+			CredentialBlobSize: uint32(len(chunk)),
+			Persist:            credPersistLocalMachine,
+			UserName:           user,
+		}
+		if len(chunk) > 0 {
+			c.CredentialBlob = &chunk[0]
+		}
+		if r, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&c)), 0); r == 0 {
+			return err
+		}
+	}
+	// remove the remaining parts of a previous larger secret
+	for ; credDelete(credTarget(key, part)) == nil; part++ {
+	}
+	return nil
+}
+
+func keyringDelete(key string) error {
+	for part := 0; ; part++ {
+		err := credDelete(credTarget(key, part))
+		switch {
+		case err == errKeyringNotFound:
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+}
+
+func keyringList() ([]string, error) {
+	filter, err := syscall.UTF16PtrFromString(keyringService + ":*")
+	if err != nil {
+		return nil, err
+	}
+	var (
+		count uint32
+		creds **credential
+	)
+	if r, _, err := procCredEnumerateW.Call(uintptr(unsafe.Pointer(filter)), 0, uintptr(unsafe.Pointer(&count)), uintptr(unsafe.Pointer(&creds))); r == 0 {
+		if err == syscall.ERROR_NOT_FOUND {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(creds)))
+	var keys []string
+	for _, c := range unsafe.Slice(creds, count) {
+		target := utf16PtrToString(c.TargetName)
+		if key, ok := strings.CutPrefix(target, keyringService+":"); ok && !strings.Contains(key, "#") {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func utf16PtrToString(p *uint16) string {
+	n := 0
+	for ptr := unsafe.Pointer(p); *(*uint16)(ptr) != 0; n++ {
+		ptr = unsafe.Add(ptr, 2)
+	}
+	return syscall.UTF16ToString(unsafe.Slice(p, n))
+}
@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// watchLock calls drop once when the screen locks or the machine wakes from
+// sleep, until ctx is done. Sleep is noticed from the monotonic clock, which
+// stops while the machine sleeps unlike the wall clock.
+func watchLock(ctx context.Context, drop func(reason string)) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		slept := now.Round(0).Sub(last.Round(0)) - now.Sub(last)
+		last = now
+		switch {
+		case slept > time.Minute:
+			drop("the machine slept for " + slept.Round(time.Second).String())
+			return
+		case screenLocked():
+			drop("the screen is locked")
+			return
+		}
+	}
+}
+
+// dropCachedSessions removes the cached sessions of roleArn, whatever their
+// source credentials and parameters.
+func dropCachedSessions(roleArn string) error {
+	dir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	var names []string
+	if useKeyring() {
+		keys, err := keyringList()
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if hash, ok := strings.CutPrefix(k, "session/"); ok {
+				names = append(names, filepath.Join(dir, "sessions", hash+".json"))
+			}
+		}
+	} else if names, err = filepath.Glob(filepath.Join(dir, "sessions", "*.json")); err != nil {
+		return err
+	}
+	for _, name := range names {
+		b, err := readSessionCache(name)
+		if err != nil {
+			continue
+		}
+		var s cachedSession
+		err = json.Unmarshal(b, &s)
+		clear(b)
+		if err != nil || s.AssumedRoleUser == nil {
+			continue
+		}
+		if c, err := newCaller(*s.AssumedRoleUser.Arn); err == nil && c.kind == "role" {
+			if n, err := localRoleName(roleArn, c.account); err == nil && n == c.name {
+				removeSessionCache(name)
+			}
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -10,13 +11,17 @@ import (
 	"os/exec"
 	"os/signal"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/johejo/aws-assume-role/pkg/assumerole"
 )
 
 var (
@@ -27,100 +32,871 @@ var (
 	serialNumber    string
 	tokenCode       string
 	sourceIdentity  string
+	roleName        string
+	listRoles       bool
+	printExport     bool
+	printUnset      bool
+	shell           string
+	githubEnv       bool
+	githubOutputs   bool
+	output          string
+	rateLimit       int
+
+	retryMaxAttempts int
+	retryBaseDelay   time.Duration
+	retryMaxDelay    time.Duration
+	retryBudgetSize  int
+
+	strictPermissions bool
+
+	force           bool
+	chain           bool
+	ciMode          bool
+	preflightCheck  bool
+	debugBundle     string
+	noReauth        bool
+	javaToolOptions bool
+	sdkStore        string
+	tempProfile     string
+	roleFrom        string
+	roleTags        string
+	accountName     string
+	scope           string
+	shareWindow     time.Duration
+	noCache         bool
+	summaryFD       int
+	summaryFile     string
+
+	cacheExpiryWindow  time.Duration
+	refreshCredentials bool
+	totpSecret         string
+
+	sessionToken bool
+
+	region              string
+	fips                bool
+	endpointURL         string
+	stsRegionalEndpoint string
+	retryMode           string
+
+	writeProfile    string
+	credentialsFile string
+
+	fanout         bool
+	roleArnsFile   string
+	fanoutParallel int
+
+	console            bool
+	consoleOpen        bool
+	consoleDestination string
+
+	allocTTY bool
+
+	selectMode     bool
+	selectFrom     string
+	selectRoleName string
+
+	keyringMode   bool
+	keyringSource string
+
+	ssoStartURL  string
+	ssoRegion    string
+	ssoAccountID string
+	ssoRoleName  string
+
+	webIdentityTokenFile string
+	providerID           string
+	deriveIdentity       bool
+	identityTags         string
+
+	generatedSessionName bool
+	generatedTokenCode   bool
+
+	roleArns         []string
+	roleSessionNames []string
+	externalIDs      []string
+
+	tagFlags          []types.Tag
+	sessionTags       []types.Tag
+	transitiveTagKeys []string
+	policyArns        []string
+	policy            string
+	policyFile        string
+	requireMFA        bool
 )
 
 func init() {
-	flag.StringVar(&roleArn, "role-arn", "", "role ARN (required)")
-	flag.StringVar(&roleSessionName, "role-session-name", "", "role session name (default unix nano timestamp)")
-	flag.DurationVar(&duration, "duration", 900*time.Second, "role session duration")
-	flag.StringVar(&externalID, "external-id", "", "external ID")
+	flag.Var(&repeatedValue{&roleArns, &roleArn, ","}, "role-arn", "role `ARN` (required), repeat or separate with commas to assume the roles in order (role chaining)")
+	flag.StringVar(&roleFrom, "role-from", "", "look up the role ARN from an output: cfn:STACK:OUTPUT, tf:DIR:OUTPUT or tfstate:FILE:OUTPUT")
+	flag.StringVar(&roleTags, "role-tags", "", "assume the role of the account tagged with all of the `tags` (e.g. team=payments,env=prod)")
+	flag.StringVar(&accountName, "account-name", "", "account `name` (or ID) of the role: -role-arn can then be a role name, and a role ARN must be in the account")
+	flag.Var(&repeatedValue{&roleSessionNames, &roleSessionName, ""}, "role-session-name", "role session `name` (default unix nano timestamp), repeat for each role of a chain")
+	duration = 900 * time.Second
+	flag.Var((*durationValue)(&duration), "duration", "role session `duration`, or max for the maximum session duration of the role")
+	flag.Var(&repeatedValue{&externalIDs, &externalID, ""}, "external-id", "external `ID`, repeat for each role of a chain")
 	flag.StringVar(&serialNumber, "serial-number", "", "MFA serial number")
 	flag.StringVar(&tokenCode, "token-code", "", "MFA token code provided by MFA device")
 	flag.StringVar(&sourceIdentity, "source-identity", "", "source identity")
+	flag.Var((*tagValue)(&tagFlags), "tag", "session tag as `key=value`, repeat for several tags")
+	flag.Var(&repeatedValue{values: &transitiveTagKeys, sep: ","}, "transitive-tag-key", "`key` of a session tag passed on to the roles assumed with the session (role chaining), repeat or separate with commas")
+	flag.Var(&repeatedValue{values: &policyArns, sep: ","}, "policy-arn", "`ARN` of a managed policy restricting the session, repeat or separate with commas")
+	flag.StringVar(&policy, "policy", "", "inline session policy `JSON` restricting the session")
+	flag.StringVar(&policyFile, "policy-file", "", "read the inline session policy from the `file`")
+	flag.StringVar(&roleName, "role", "", "role name from the catalog (tool config or ~/.aws/config profiles)")
+	flag.StringVar(&roleName, "profile", "", "alias of -role")
+	flag.BoolVar(&listRoles, "list-roles", false, "list roles in the catalog with their source")
+	flag.BoolVar(&printExport, "print-export", false, "print shell commands exporting the credentials instead of running commands")
+	flag.BoolVar(&printUnset, "print-unset", false, "print shell commands unsetting the credentials")
+	flag.BoolVar(&githubEnv, "github-env", false, "write the credentials to $GITHUB_ENV and the expiration to $GITHUB_OUTPUT instead of running commands")
+	flag.BoolVar(&githubOutputs, "github-outputs", false, "set the aws-account-id and aws-expiration step outputs in GitHub Actions")
+	flag.StringVar(&output, "output", "", "print the credentials in the format instead of running commands (json: credential_process, powershell: Set-AWSCredential, java: system properties)")
+	flag.BoolVar(&sessionToken, "session-token", false, "get a session of the IAM user of the source credentials with sts:GetSessionToken (with MFA when -serial-number is set) instead of assuming a role")
+	flag.StringVar(&writeProfile, "write-profile", "", "write the credentials to the `profile` of the shared credentials file instead of running commands")
+	flag.StringVar(&credentialsFile, "credentials-file", "", "shared credentials `file` of -write-profile (default $AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials)")
+	flag.BoolVar(&fanout, "fanout", false, "run the commands once per role of the repeated -role-arn concurrently instead of chaining the roles")
+	flag.StringVar(&roleArnsFile, "role-arns-file", "", "run the commands once per role ARN of the `file` (one per line) concurrently, like -fanout")
+	flag.IntVar(&fanoutParallel, "parallel", 8, "maximum commands running at the same time with -fanout")
+	flag.BoolVar(&console, "console", false, "print a URL signing in to the AWS console with the role instead of running commands")
+	flag.BoolVar(&consoleOpen, "console-open", false, "open the console sign-in URL in the browser instead of running commands")
+	flag.StringVar(&consoleDestination, "console-destination", "", "console `path` to open after signing in (e.g. s3 or ec2/home)")
+	flag.IntVar(&rateLimit, "rate-limit", 10, "maximum AssumeRole calls per second shared by concurrent invocations on the machine (0 to disable)")
+	flag.StringVar(&region, "region", "", "AWS `region` of the calls of the tool (default from the environment or the config)")
+	flag.BoolVar(&fips, "fips", false, "use FIPS endpoints")
+	flag.StringVar(&endpointURL, "endpoint-url", "", "`URL` of the STS endpoint, e.g. a VPC endpoint")
+	flag.StringVar(&stsRegionalEndpoint, "sts-regional-endpoint", "regional", "regional, or legacy for the global STS endpoint of the aws partition")
+	flag.IntVar(&retryMaxAttempts, "retries", 5, "maximum attempts of throttled or failed STS calls")
+	flag.IntVar(&retryMaxAttempts, "max-attempts", 5, "alias of -retries")
+	flag.StringVar(&retryMode, "retry-mode", "standard", "standard, or adaptive to also slow down all calls of the process after throttling")
+	flag.DurationVar(&retryBaseDelay, "retry-base-delay", 200*time.Millisecond, "base delay of the exponential backoff with jitter (x4 for throttling)")
+	flag.DurationVar(&retryMaxDelay, "retry-max-delay", 20*time.Second, "maximum delay between attempts")
+	flag.IntVar(&retryBudgetSize, "retry-budget", 20, "maximum retries of all calls in the process")
+	flag.BoolVar(&strictPermissions, "strict-permissions", false, "refuse to run when config or cache files are accessible by other users")
+	flag.BoolVar(&deriveIdentity, "derive-identity", false, "set source identity and the Principal session tag from the IAM Identity Center or OIDC identity of the source credentials")
+	flag.StringVar(&identityTags, "identity-tags", "", "session tags taken from OIDC token claims with -derive-identity (e.g. Department=department,Team=groups)")
+	flag.BoolVar(&force, "force", false, "assume the role from the original source credentials when the environment already has credentials issued by this tool")
+	flag.BoolVar(&chain, "chain", false, "assume the role from the credentials issued by this tool in the environment")
+	flag.BoolVar(&preflightCheck, "preflight", false, "check the trust policy of the role before assuming it and explain what is missing")
+	flag.StringVar(&debugBundle, "debug-bundle", "", "write a redacted diagnostic archive (tar.gz) to the `path` on failure")
+	flag.BoolVar(&noReauth, "no-reauth", false, "fail instead of running aws sso login when the SSO session of the source profile has expired")
+	flag.BoolVar(&javaToolOptions, "java-tool-options", false, "also pass the credentials to JVMs as system properties in JAVA_TOOL_OPTIONS")
+	flag.StringVar(&sdkStore, "sdk-store", "", "save the credentials as the `profile` of the encrypted AWS SDK Store of .NET on Windows instead of running commands")
+	flag.StringVar(&tempProfile, "temp-profile", "", "pass the credentials to the command as the `profile` of temporary AWS_CONFIG_FILE and AWS_SHARED_CREDENTIALS_FILE, removed on exit")
+	flag.StringVar(&scope, "scope", "", "restrict the session to the actions of the `scopes` of the tool config with a generated session policy (comma separated)")
+	flag.BoolVar(&noCache, "no-cache", false, "do not reuse cached sessions, except the ones shared within -share-window")
+	flag.DurationVar(&cacheExpiryWindow, "cache-expiry-window", 5*time.Minute, "refresh cached sessions expiring within the window")
+	flag.DurationVar(&shareWindow, "share-window", 10*time.Second, "share the session with identical invocations on the machine within the window even with -no-cache (0 disables)")
+	flag.IntVar(&summaryFD, "summary-fd", 0, "write a JSON summary of the run to the file descriptor after the command exits")
+	flag.StringVar(&summaryFile, "summary-file", "", "write a JSON summary of the run to the `file` after the command exits")
+	flag.BoolVar(&refreshCredentials, "refresh", false, "serve the credentials to the command through a local container credentials endpoint and renew the session before it expires")
+	flag.StringVar(&totpSecret, "totp-secret", "", "base32 `secret` of the virtual MFA device to generate token codes with, or env:NAME or file:PATH holding it")
+	flag.StringVar(&ssoStartURL, "sso-start-url", "", "get the source credentials from the IAM Identity Center portal at the `URL`, logging in with the browser when needed")
+	flag.StringVar(&ssoRegion, "sso-region", "", "`region` of IAM Identity Center (default the region of the config)")
+	flag.StringVar(&ssoAccountID, "sso-account-id", "", "account `ID` of the IAM Identity Center role")
+	flag.StringVar(&ssoRoleName, "sso-role-name", "", "`name` of the permission set of the IAM Identity Center role, which is the role itself without -role-arn")
+	flag.StringVar(&webIdentityTokenFile, "web-identity-token-file", "", "assume the role with sts:AssumeRoleWithWebIdentity and the OIDC token in the `file` instead of the source credentials")
+	flag.StringVar(&providerID, "provider-id", "", "provider of an OAuth 2.0 access token given with -web-identity-token-file (www.amazon.com or graph.facebook.com)")
+	flag.BoolVar(&ciMode, "ci", false, "non-interactive mode: never prompt and log JSON lines (default true when a CI system is detected)")
+	flag.BoolVar(&selectMode, "select", false, "pick the role with a fuzzy-searchable list on the terminal when no role is given")
+	flag.StringVar(&selectFrom, "select-from", "config", "`sources` of the roles of -select (comma separated): config for the roles of the config files, iam for the roles of the account assumable by the source credentials, organizations for -select-role-name in every account of the organization")
+	flag.StringVar(&selectRoleName, "select-role-name", "OrganizationAccountAccessRole", "`name` of the role in each account listed by -select-from organizations")
+	flag.BoolVar(&keyringMode, "keyring", false, "cache the sessions in the OS keyring (macOS Keychain, Windows Credential Manager or the Secret Service with secret-tool) instead of plain files")
+	flag.StringVar(&keyringSource, "keyring-source", "", "use the source credentials stored as `name` in the OS keyring by the keyring subcommand, implies -keyring")
+	flag.BoolVar(&allocTTY, "tty", false, "run the command on a pseudo-terminal proxied to the terminal, for full-screen programs behaving differently when not in control of one")
+	flag.StringVar(&shell, "shell", "", "shell syntax of -print-export and -print-unset: sh, bash, zsh, fish or powershell (default detected from the parent process and $SHELL)")
+}
+
+var subcommands = map[string]func(args []string) error{
+	"use":            runUse,
+	"current":        runCurrent,
+	"init":           runInit,
+	"integrate":      runIntegrate,
+	"git-credential": runGitCredential,
+	"eks":            runEKS,
+	"import":         runImport,
+	"prompt":         runPrompt,
+	"pop":            runPop,
+	"serve":          runServe,
+	"warm":           runWarm,
+	"keyring":        runKeyring,
 }
 
 func main() {
+	defer runCleanup()
+
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			defer cleanupOnSignal()()
+			if err := run(os.Args[2:]); err != nil {
+				fatal(err)
+			}
+			return
+		}
+	}
+
 	flag.Usage = func() {
 		fmt.Fprintf(
 			flag.CommandLine.Output(),
 			"Usage: %s\n\n"+
-				"  aws-assume-role -role-arn [ROLE ARN] -- [COMMANDS...]\n\n",
+				"  aws-assume-role -role-arn [ROLE ARN] -- [COMMANDS...]\n"+
+				"  aws-assume-role -role [NAME] -- [COMMANDS...]\n"+
+				"  aws-assume-role [NAME] [FLAGS...] -- [COMMANDS...]\n"+
+				"  aws-assume-role -list-roles\n"+
+				"  aws-assume-role use [-dir] [NAME]\n"+
+				"  aws-assume-role current\n"+
+				"  aws-assume-role init bash|zsh|fish\n"+
+				"  aws-assume-role integrate aws-cli [NAMES...]\n"+
+				"  aws-assume-role git-credential [FLAGS...] get\n"+
+				"  aws-assume-role eks kubeconfig -cluster [NAME] [FLAGS...]\n"+
+				"  aws-assume-role import granted [REGISTRY|AWS CONFIG]...\n"+
+				"  aws-assume-role prompt|pop\n"+
+				"  aws-assume-role serve [FLAGS...] [NAMES...]\n"+
+				"  aws-assume-role warm [FLAGS...] [NAMES...]\n"+
+				"  aws-assume-role keyring add|remove|list\n\n",
 			os.Args[0],
 		)
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
-	if roleArn == "" {
-		log.Fatal("role-arn is required")
+	if shell == "" {
+		shell = detectShell()
 	}
-	if roleSessionName == "" {
-		roleSessionName = strconv.FormatInt(time.Now().UnixNano(), 10)
+	if printUnset {
+		if err := printUnsets(os.Stdout, shell, credentialKeys); err != nil {
+			fatal(err)
+		}
+		return
 	}
 
+	var targets []string
+	if fanout || roleArnsFile != "" {
+		flag.Visit(func(f *flag.Flag) {
+			if slices.Contains(fanoutExclusive, f.Name) {
+				fatalf("-%s cannot be used with -fanout", f.Name)
+			}
+		})
+		var err error
+		if targets, err = fanoutTargets(); err != nil {
+			fatal(err)
+		}
+		// each target is assumed on its own instead of chaining them
+		roleArn, roleArns = targets[0], targets[:1]
+	}
+	if args := flag.Args(); roleArn == "" && roleName == "" && !lookupRole() && !selectMode && len(args) > 0 && !afterDashDash() {
+		roleName = args[0]
+		if err := flag.CommandLine.Parse(args[1:]); err != nil {
+			fatal(err)
+		}
+	}
+	setupCIMode()
+	if listRoles {
+		checkPermissions()
+		c, err := loadCatalog()
+		if err != nil {
+			fatal(err)
+		}
+		if err := c.print(os.Stdout); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	stack := readStack()
+
 	ctx := context.Background()
 
 	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 	defer cancel()
 
-	cfg, err := config.LoadDefaultConfig(ctx)
+	loadOpts := resolveRole(ctx)
+
+	if targets != nil {
+		if len(flag.Args()) == 0 {
+			fatal("-fanout requires commands")
+		}
+		exit(runFanout(ctx, loadOpts, targets, flag.Args()))
+	}
+
+	assumeStart := time.Now()
+	role, cfg, err := assumeRole(ctx, loadOpts)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
+	summary := newRunSummary(role, time.Since(assumeStart))
 
-	stsClient := sts.NewFromConfig(cfg)
+	env, wipe := credentialEnv(role.Credentials)
+	defer wipe()
+	env = append(env, markerKey+"="+roleArn)
 
-	role, err := stsClient.AssumeRole(ctx, &sts.AssumeRoleInput{
-		RoleArn:         ptr(roleArn),
-		RoleSessionName: ptr(roleSessionName),
-		DurationSeconds: ptr(int32(duration.Seconds())),
-		ExternalId:      ptr(externalID),
-		SerialNumber:    ptr(serialNumber),
-		SourceIdentity:  ptr(sourceIdentity),
-		TokenCode:       ptr(tokenCode),
-	})
-	if err != nil {
-		log.Fatal(err)
+	args := flag.Args()
+	current := stackEntry{Name: roleLabel(), Arn: roleArn}
+	if len(args) == 0 && len(stack) > 0 {
+		// the credentials of the current shell are replaced
+		stack[len(stack)-1] = current
+	} else {
+		stack = append(stack, current)
+	}
+	env = append(env, stackEnv(stack)...)
+	if javaToolOptions {
+		e, wipeJava := javaToolOptionsEnv(role.Credentials)
+		env = append(env, e)
+		wipeCreds := wipe
+		wipe = func() {
+			wipeCreds()
+			wipeJava()
+		}
+	}
+	if githubEnv {
+		if len(args) > 0 {
+			fatal("commands cannot be used with -github-env")
+		}
+		githubMask(os.Stdout, *role.Credentials.AccessKeyId, *role.Credentials.SecretAccessKey, *role.Credentials.SessionToken)
+		ghEnv := slices.Clip(env)
+		if cfg.Region != "" {
+			ghEnv = append(ghEnv, "AWS_REGION="+cfg.Region, "AWS_DEFAULT_REGION="+cfg.Region)
+		}
+		if err := appendGitHubFile("GITHUB_ENV", ghEnv); err != nil {
+			fatal(err)
+		}
+		if err := writeGitHubOutputs(role); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if inGitHubActions() {
+		// the runner also reads workflow commands from stderr, which keeps
+		// stdout clean for -output and -print-export
+		githubMask(os.Stderr, *role.Credentials.AccessKeyId, *role.Credentials.SecretAccessKey, *role.Credentials.SessionToken)
+		if githubOutputs {
+			if err := writeGitHubOutputs(role); err != nil {
+				fatal(err)
+			}
+		}
+	}
+	if console || consoleOpen {
+		if len(args) > 0 {
+			fatal("commands cannot be used with -console")
+		}
+		u, err := consoleURL(ctx, cfg.Region, role.Credentials, consoleDestination)
+		if err != nil {
+			fatal(err)
+		}
+		if consoleOpen {
+			err := openBrowser(u)
+			if err == nil {
+				return
+			}
+			log.Printf("cannot open the browser: %v", err)
+		}
+		fmt.Println(u)
+		return
+	}
+	if output != "" {
+		if len(args) > 0 {
+			fatal("commands cannot be used with -output")
+		}
+		if err := printCredentials(os.Stdout, output, role.Credentials); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if sdkStore != "" {
+		if len(args) > 0 {
+			fatal("commands cannot be used with -sdk-store")
+		}
+		if err := writeSDKStore(sdkStore, role.Credentials); err != nil {
+			fatal(err)
+		}
+		log.Printf("saved the credentials as profile %s of the AWS SDK Store", sdkStore)
+		return
+	}
+	if writeProfile != "" {
+		if len(args) > 0 {
+			fatal("commands cannot be used with -write-profile")
+		}
+		name, err := writeCredentialsProfile(credentialsFile, writeProfile, role.Credentials)
+		if err != nil {
+			fatal(err)
+		}
+		log.Printf("wrote the credentials to profile %s of %s, expiring at %s", writeProfile, name, role.Credentials.Expiration.Local().Format(time.RFC3339))
+		return
+	}
+	if printExport {
+		if len(args) > 0 {
+			fatal("commands cannot be used with -print-export")
+		}
+		if err := printExports(os.Stdout, shell, env); err != nil {
+			fatal(err)
+		}
+		return
 	}
 
-	env := []string{
-		"AWS_ACCESS_KEY_ID=" + *role.Credentials.AccessKeyId,
-		"AWS_SECRET_ACCESS_KEY=" + *role.Credentials.SecretAccessKey,
-		"AWS_SESSION_TOKEN=" + *role.Credentials.SessionToken,
+	if refreshCredentials {
+		if len(args) == 0 || tempProfile != "" {
+			fatal("-refresh requires commands and cannot be used with -temp-profile")
+		}
+		endpointEnv, err := startCredentialServer(ctx, role.Credentials, func(ctx context.Context) (*types.Credentials, error) {
+			role, _, err := assumeRole(ctx, loadOpts)
+			if err != nil {
+				return nil, err
+			}
+			return role.Credentials, nil
+		})
+		if err != nil {
+			fatal(err)
+		}
+		// the command reads the credentials from the endpoint only
+		env = slices.DeleteFunc(env, func(e string) bool {
+			k, _, _ := strings.Cut(e, "=")
+			return slices.Contains(credentialKeys[:3], k)
+		})
+		env = append(env, endpointEnv...)
 	}
+	if tempProfile != "" {
+		if len(args) == 0 {
+			fatal("-temp-profile requires commands")
+		}
+		profileEnv, err := writeTempProfile(tempProfile, cfg.Region, role.Credentials)
+		if err != nil {
+			fatal(err)
+		}
+		// the command reads the credentials from the profile only
+		env = slices.DeleteFunc(env, func(e string) bool {
+			k, _, _ := strings.Cut(e, "=")
+			return slices.Contains(credentialKeys[:3], k)
+		})
+		env = append(env, profileEnv...)
+	}
+
 	for _, e := range os.Environ() {
 		k, _, found := strings.Cut(e, "=")
 		if !found {
-			log.Fatal("invalid environ")
-		}
-		switch k {
-		case
-			"AWS_ROLE_ARN",
-			"AWS_ACCESS_KEY_ID",
-			"AWS_SECRET_ACCESS_KEY",
-			"AWS_SESSION_TOKEN",
-			"AWS_WEB_IDENTITY_TOKEN_FILE":
+			fatal("invalid environ")
+		}
+		if slices.Contains(credentialKeys, k) || slices.Contains(conflictingKeys, k) {
+			continue
+		}
+		if javaToolOptions && k == javaToolOptionsKey {
+			continue
+		}
+		if tempProfile != "" && slices.Contains(profileKeys, k) {
+			continue
+		}
+		if refreshCredentials && slices.Contains(containerKeys, k) {
 			continue
 		}
 		env = append(env, e)
 	}
 
-	args := flag.Args()
-	var cmd *exec.Cmd
-	if len(args) == 1 {
-		cmd = exec.CommandContext(ctx, args[0])
-	} else if len(args) > 1 {
-		cmd = exec.CommandContext(ctx, args[0], args[1:]...)
-	} else {
+	if len(args) == 0 {
 		log.Println("no commands")
-		os.Exit(0)
+		exit(0)
 	}
-	cmd.Env = env
+	cmd, err := newCommand(args)
+	if err != nil {
+		fatal(err)
+	}
+	cmd.Env = wslEnv(args, env)
+	cmd.Stdin = os.Stdin
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
-	if err := cmd.Run(); err != nil {
-		log.Fatal(err)
+	if isInit() {
+		code := runAsInit(cmd, func() {
+			env, cmd.Env = nil, nil
+			wipe()
+		})
+		if err := writeSummary(summary, code); err != nil {
+			log.Printf("summary: %v", err)
+		}
+		exit(code)
+	}
+	wait := cmd.Wait
+	if allocTTY {
+		wait, err = startTTY(cmd)
+	} else {
+		err = cmd.Start()
+	}
+	if err != nil {
+		fatal(err)
+	}
+	stop := forwardSignals(cmd)
+	// the child has its own copy of the environment
+	env, cmd.Env = nil, nil
+	wipe()
+	err = wait()
+	stop()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		fatal(err)
+	}
+	// the wrapper is transparent: it exits like the command
+	code := exitCode(cmd.ProcessState)
+	if err := writeSummary(summary, code); err != nil {
+		log.Printf("summary: %v", err)
+	}
+	exit(code)
+}
+
+// resolveRole fills the flags from the catalog entry given by -role or the
+// default role, and returns the options for loading the source credentials.
+// The picker of -select is canceled when ctx is done.
+func resolveRole(ctx context.Context) []func(*config.LoadOptions) error {
+	setupCIMode()
+	checkPermissions()
+
+	if (ssoStartURL != "" || ssoAccountID != "" || ssoRoleName != "") && (ssoStartURL == "" || ssoAccountID == "" || ssoRoleName == "") {
+		fatal("-sso-start-url, -sso-account-id and -sso-role-name are required together")
+	}
+	if ssoStartURL != "" && webIdentityTokenFile != "" {
+		fatal("-sso-start-url and -web-identity-token-file are mutually exclusive")
+	}
+	if keyringSource != "" && (ssoStartURL != "" || webIdentityTokenFile != "") {
+		fatal("-keyring-source cannot be used with -sso-start-url or -web-identity-token-file")
+	}
+	if sessionToken && (roleArn != "" || roleName != "" || roleFrom != "" || roleTags != "" || accountName != "" || ssoStartURL != "" || webIdentityTokenFile != "") {
+		// GetSessionToken needs the long-term keys of an IAM user
+		fatal("-session-token cannot be used with a role")
+	}
+
+	if roleArn == "" && roleName == "" && !lookupRole() && selectMode {
+		if err := pickRole(ctx); err != nil {
+			fatal(err)
+		}
+	}
+	if roleArn == "" && roleName == "" && !lookupRole() {
+		name, _, err := currentDefault()
+		if err != nil {
+			fatal(err)
+		}
+		roleName = name
+	}
+
+	sessionTags = tagFlags
+	if policyFile != "" {
+		if policy != "" {
+			fatal("-policy and -policy-file are mutually exclusive")
+		}
+		b, err := os.ReadFile(policyFile)
+		if err != nil {
+			fatal(err)
+		}
+		policy = string(b)
+	}
+
+	var loadOpts []func(*config.LoadOptions) error
+	if roleName != "" {
+		c, err := loadCatalog()
+		if err != nil {
+			fatal(err)
+		}
+		e, ok := c.lookup(roleName)
+		if !ok {
+			fatalf("role %q is not found in the catalog", roleName)
+		}
+		loadOpts = applyCatalogEntry(e)
+	}
+
+	if roleArn == "" && !lookupRole() {
+		fatal("role-arn is required")
+	}
+	endpointOpts, err := endpointOptions()
+	if err != nil {
+		fatal(err)
+	}
+	loadOpts = append(loadOpts, endpointOpts...)
+	loadOpts = append(loadOpts, keyringOptions()...)
+	if retryMode != "standard" && retryMode != "adaptive" {
+		fatalf("invalid -retry-mode %q, must be standard or adaptive", retryMode)
+	}
+	if p := os.Getenv("AWS_PROFILE"); p != "" && isManagedProfile(p) {
+		loadOpts = append([]func(*config.LoadOptions) error{config.WithSharedConfigProfile("default")}, loadOpts...)
+	}
+	if scope != "" {
+		if policy != "" || len(policyArns) > 0 {
+			// session policies are combined as a union, which would widen the scope
+			fatal("-scope cannot be used with other session policies")
+		}
+		p, err := scopePolicy(splitList(scope))
+		if err != nil {
+			fatal(err)
+		}
+		policy = p
+	}
+	if requireMFA && serialNumber == "" {
+		fatalf("role %s requires MFA but no serial number is configured", roleName)
+	}
+	if outer := os.Getenv(markerKey); outer != "" {
+		switch {
+		case chain:
+		case force || replacesCredentials():
+			for _, k := range credentialKeys {
+				os.Unsetenv(k)
+			}
+		default:
+			fatalf("the environment already has credentials of %s issued by aws-assume-role, use -chain to assume %s from them or -force to assume it from the original credentials", outer, roleArn)
+		}
+	}
+	if roleSessionName == "" {
+		roleSessionName = strconv.FormatInt(time.Now().UnixNano(), 10)
+		generatedSessionName = true
+	}
+	return loadOpts
+}
+
+// assumeRole assumes the role from the source credentials, logging in again
+// once when their SSO session has expired.
+func assumeRole(ctx context.Context, loadOpts []func(*config.LoadOptions) error) (*sts.AssumeRoleOutput, aws.Config, error) {
+	role, cfg, err := assumeRoleOnce(ctx, loadOpts)
+	if err == nil || noReauth || !isSSOSessionExpired(err) {
+		return role, cfg, err
+	}
+	if err := reauthenticate(ctx, cfg); err != nil {
+		return nil, cfg, err
+	}
+	return assumeRoleOnce(ctx, loadOpts)
+}
+
+func assumeRoleOnce(ctx context.Context, loadOpts []func(*config.LoadOptions) error) (*sts.AssumeRoleOutput, aws.Config, error) {
+	loadOpts = append([]func(*config.LoadOptions) error{config.WithHTTPClient(sharedHTTPClient())}, loadOpts...)
+	if webIdentityTokenFile != "" {
+		// the token replaces the default credential chain
+		loadOpts = append(loadOpts, config.WithCredentialsProvider(aws.AnonymousCredentials{}))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return nil, cfg, err
+	}
+	if ssoStartURL != "" {
+		cfg.Credentials = aws.NewCredentialsCache(&ssoCredentials{cfg: cfg})
+		if ssoOnly() {
+			role, err := ssoRoleSession(ctx, cfg)
+			return role, cfg, err
+		}
+	}
+
+	var userID string
+	switch {
+	case accountName != "" && !lookupRole():
+		id, err := resolveAccount(ctx, cfg, accountName)
+		if err != nil {
+			return nil, cfg, err
+		}
+		if strings.HasPrefix(roleArn, "arn:") {
+			if a, _ := accountIDFromArn(roleArn); a != id {
+				return nil, cfg, fmt.Errorf("%s is not a role of account %s (%s)", roleArn, accountName, id)
+			}
+		} else {
+			roleArn = "arn:" + partition(cfg.Region) + ":iam::" + id + ":role/" + roleArn
+		}
+	case sessionToken:
+		id, err := callerIdentity(ctx, cfg)
+		if err != nil {
+			return nil, cfg, err
+		}
+		roleArn, userID = *id.Arn, *id.UserId
+	case roleArn != "":
+	case roleFrom != "":
+		if roleArn, err = resolveRoleFrom(ctx, cfg, roleFrom); err != nil {
+			return nil, cfg, err
+		}
+	case roleTags != "":
+		if roleArn, err = resolveRoleTags(ctx, cfg, roleTags); err != nil {
+			return nil, cfg, err
+		}
+	}
+
+	if role := agentSession(ctx); role != nil {
+		return role, cfg, nil
+	}
+
+	cfg.APIOptions = append(cfg.APIOptions, recordEndpoint)
+	debugState.Lock()
+	debugState.region = cfg.Region
+	debugState.Unlock()
+
+	if deriveIdentity {
+		if err := applyFederatedIdentity(ctx, cfg); err != nil {
+			return nil, cfg, err
+		}
+	}
+
+	var cacheFile string
+	var role *sts.AssumeRoleOutput
+	if !noCache || shareWindow > 0 {
+		if cacheFile, err = sessionCacheFile(ctx, cfg); err != nil {
+			return nil, cfg, err
+		}
+	}
+	if cacheFile != "" {
+		if role = loadCachedSession(cacheFile); role != nil {
+			return role, cfg, nil
+		}
+	}
+	if serialNumber != "" && mfaSession == nil && (tokenCode == "" || generatedTokenCode) {
+		// only asked when no cached session can be used, and again for
+		// every new session since codes cannot be reused. The lock is not
+		// held yet, so other invocations do not wait for the user.
+		if tokenCode, err = mfaTokenCode(ctx); err != nil {
+			return nil, cfg, err
+		}
+		generatedTokenCode = true
+	}
+	release, err := acquireSTSSlot(ctx, roleArn, func() bool {
+		if cacheFile != "" {
+			role = loadCachedSession(cacheFile)
+		}
+		return role != nil
+	})
+	if err != nil {
+		return nil, cfg, err
+	}
+	defer release()
+	if role != nil {
+		return role, cfg, nil
+	}
+
+	if mfaSession != nil && serialNumber != "" {
+		cfg.Credentials = mfaSession
+	}
+	chained := len(roleArns) > 1 && roleArns[len(roleArns)-1] == roleArn
+	if chained {
+		if cfg, err = assumeHops(ctx, cfg); err != nil {
+			return nil, cfg, diagnose(err)
+		}
+	}
+	if preflightCheck && !sessionToken && (chained || webIdentityTokenFile == "") {
+		if err := preflight(ctx, cfg); err != nil {
+			return nil, cfg, err
+		}
+	}
+	stsClient := sts.NewFromConfig(cfg, func(o *sts.Options) {
+		o.Retryer = aws.NopRetryer{}
+	})
+
+	durations := []time.Duration{duration}
+	switch {
+	case duration == durationMax && sessionToken:
+		durations = sessionTokenDurations
+	case duration == durationMax:
+		durations = candidateDurations(ctx, cfg, chained)
+	}
+
+	if webIdentityTokenFile != "" && !chained {
+		warnWebIdentityIgnored()
+	}
+	for i, d := range durations {
+		switch {
+		case sessionToken:
+			role, err = getSessionToken(ctx, stsClient, d, userID)
+		default:
+			// With a chain, cfg already has the credentials of the last hop.
+			role, err = roleProvider(stsClient, d).AssumeTarget(ctx, nil)
+		}
+		if err == nil || i == len(durations)-1 || !isDurationTooLong(err) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, cfg, diagnose(err)
+	}
+	if cacheFile != "" {
+		if err := storeCachedSession(cacheFile, role); err != nil {
+			log.Printf("cannot cache the session: %v", err)
+		}
+	}
+	return role, cfg, nil
+}
+
+// roleProvider returns the provider assuming roleArn for d with stsClient,
+// after the intermediate roles of the chain given with several -role-arn.
+func roleProvider(stsClient *sts.Client, d time.Duration) *assumerole.Provider {
+	return assumerole.New(stsClient, func(o *assumerole.Options) {
+		o.RoleARN = roleArn
+		o.RoleSessionName = roleSessionName
+		o.Duration = d
+		o.ExternalID = externalID
+		if mfaSession == nil {
+			o.SerialNumber = serialNumber
+			o.TokenCode = func() (string, error) { return tokenCode, nil }
+		}
+		o.SourceIdentity = sourceIdentity
+		o.Tags = sessionTags
+		o.TransitiveTagKeys = transitiveTagKeys
+		o.PolicyARNs = policyArns
+		o.Policy = policy
+		if webIdentityTokenFile != "" {
+			o.WebIdentityToken = webIdentityToken
+			o.ProviderID = providerID
+		}
+		if len(roleArns) > 1 && roleArns[len(roleArns)-1] == roleArn {
+			for i, arn := range roleArns[:len(roleArns)-1] {
+				o.Hops = append(o.Hops, assumerole.Hop{
+					RoleARN:         arn,
+					RoleSessionName: hopValue(roleSessionNames, i, roleSessionName),
+					ExternalID:      hopValue(externalIDs, i, ""),
+				})
+			}
+		}
+		o.Retry = withRetry
+	})
+}
+
+// lookupRole reports if the role ARN is looked up with the source credentials.
+func lookupRole() bool {
+	return roleFrom != "" || roleTags != "" || ssoOnly() || sessionToken
+}
+
+// afterDashDash reports whether the remaining arguments followed "--".
+func afterDashDash() bool {
+	n := len(os.Args) - flag.NArg()
+	return n > 0 && os.Args[n-1] == "--"
+}
+
+// applyCatalogEntry fills the flags that were not given on the command line
+// from e and returns the options for loading the source credentials.
+func applyCatalogEntry(e *catalogEntry) []func(*config.LoadOptions) error {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["role-arn"] {
+		roleArn = e.RoleArn
+	}
+	if !set["role-session-name"] && e.RoleSessionName != "" {
+		roleSessionName = e.RoleSessionName
+	}
+	if !set["duration"] && e.Duration != 0 {
+		duration = e.Duration
+	}
+	if !set["external-id"] && e.ExternalID != "" {
+		externalID = e.ExternalID
+	}
+	if !set["serial-number"] && e.SerialNumber != "" {
+		serialNumber = e.SerialNumber
+	}
+	sessionTags = mergeTags(e.Tags, sessionTags)
+	if !set["transitive-tag-key"] {
+		transitiveTagKeys = e.TransitiveTagKeys
+	}
+	if !set["policy-arn"] {
+		policyArns = e.PolicyArns
+	}
+	if !set["policy"] && !set["policy-file"] {
+		policy = e.Policy
+	}
+	requireMFA = e.RequireMFA
+	if !set["derive-identity"] && e.DeriveIdentity {
+		deriveIdentity = true
+	}
+	if !set["identity-tags"] && e.IdentityTags != "" {
+		identityTags = e.IdentityTags
+	}
+	var opts []func(*config.LoadOptions) error
+	if e.SourceProfile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(e.SourceProfile))
+	}
+	if e.Region != "" {
+		opts = append(opts, config.WithRegion(e.Region))
 	}
+	return opts
 }
 
 func ptr[T any](v T) *T {
@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestMain runs the tool, or cleanupMain, instead of the tests when a test
+// runs the test binary as the tool.
+func TestMain(m *testing.M) {
+	if os.Getenv("AWS_ASSUME_ROLE_TEST_MAIN") == "1" {
+		main()
+		exit(0)
+	}
+	if mode := os.Getenv("AWS_ASSUME_ROLE_TEST_CLEANUP"); mode != "" {
+		cleanupMain(mode)
+		exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeSTS answers AssumeRole with credentials named after the role, and
+// records the access key ID signing each call.
+type fakeSTS struct {
+	mu      sync.Mutex
+	signers []string
+}
+
+func (f *fakeSTS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	_, credential, _ := strings.Cut(r.Header.Get("Authorization"), "Credential=")
+	signer, _, _ := strings.Cut(credential, "/")
+	f.mu.Lock()
+	f.signers = append(f.signers, signer)
+	f.mu.Unlock()
+	if action := r.Form.Get("Action"); action != "AssumeRole" {
+		http.Error(w, "unexpected action "+action, http.StatusBadRequest)
+		return
+	}
+	arn := r.Form.Get("RoleArn")
+	name := arn[strings.LastIndex(arn, "/")+1:]
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+<AssumeRoleResult>
+<Credentials><AccessKeyId>ASIA%s</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken><Expiration>2099-01-01T00:00:00Z</Expiration></Credentials>
+<AssumedRoleUser><Arn>arn:aws:sts::123456789012:assumed-role/%s/session</Arn><AssumedRoleId>AROAEXAMPLE:session</AssumedRoleId></AssumedRoleUser>
+</AssumeRoleResult>
+<ResponseMetadata><RequestId>1</RequestId></ResponseMetadata>
+</AssumeRoleResponse>`, strings.ToUpper(name), name)
+}
+
+// toolEnv returns the environment running the test binary as the tool with
+// source credentials from a shared credentials file, against sts.
+func toolEnv(t *testing.T, sts *httptest.Server) []string {
+	dir := t.TempDir()
+	credentials := filepath.Join(dir, "credentials")
+	if err := os.WriteFile(credentials, []byte("[default]\naws_access_key_id = AKIASOURCE\naws_secret_access_key = secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	env := []string{
+		"AWS_ASSUME_ROLE_TEST_MAIN=1",
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + dir,
+		"XDG_CACHE_HOME=" + filepath.Join(dir, "cache"),
+		"XDG_CONFIG_HOME=" + filepath.Join(dir, "config"),
+		"AWS_SHARED_CREDENTIALS_FILE=" + credentials,
+		"AWS_CONFIG_FILE=" + filepath.Join(dir, "aws-config"),
+		"AWS_REGION=us-east-1",
+		"AWS_EC2_METADATA_DISABLED=true",
+		"AWS_ASSUME_ROLE_TEST_STS=" + sts.URL,
+	}
+	return env
+}
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// mfaTokenCode returns the token code of the MFA device, generated from
+// -totp-secret or read from the terminal.
+func mfaTokenCode(ctx context.Context) (string, error) {
+	if totpSecret != "" {
+		secret, err := readSecretRef(totpSecret)
+		if err != nil {
+			return "", fmt.Errorf("-totp-secret: %w", err)
+		}
+		return totp(secret, time.Now())
+	}
+	requireInteraction("MFA device " + serialNumber + " is configured but -token-code is not given")
+	return promptTTY(ctx, "MFA code for "+serialNumber+": ")
+}
+
+// readSecretRef resolves env:NAME and file:PATH references, so secrets do not
+// have to be given on the command line.
+func readSecretRef(ref string) (string, error) {
+	switch kind, v, _ := strings.Cut(ref, ":"); kind {
+	case "env":
+		s := os.Getenv(v)
+		if s == "" {
+			return "", fmt.Errorf("%s is not set", v)
+		}
+		return s, nil
+	case "file":
+		b, err := os.ReadFile(v)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return ref, nil
+}
+
+// totp computes the RFC 6238 code (SHA-1, 30 seconds, 6 digits) used by
+// virtual MFA devices from the base32 secret.
+func totp(secret string, t time.Time) (string, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/30))
+	h := hmac.New(sha1.New, key)
+	h.Write(counter[:])
+	sum := h.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", code%1000000), nil
+}
+
+// promptTTY asks a question on the terminal, which works even when stdin and
+// stdout are redirected. It returns when ctx is done, since the signals
+// canceling ctx are not delivered to the blocked read.
+func promptTTY(ctx context.Context, prompt string) (string, error) {
+	return readTTY(ctx, prompt, false)
+}
+
+// promptTTYSecret is promptTTY without echoing the answer where the terminal
+// allows it.
+func promptTTYSecret(ctx context.Context, prompt string) (string, error) {
+	return readTTY(ctx, prompt, true)
+}
+
+func readTTY(ctx context.Context, prompt string, secret bool) (string, error) {
+	in, out := "/dev/tty", "/dev/tty"
+	if runtime.GOOS == "windows" {
+		in, out = "CONIN$", "CONOUT$"
+	}
+	r, err := os.Open(in)
+	if err != nil {
+		return "", fmt.Errorf("cannot prompt without a terminal: %w", err)
+	}
+	defer r.Close()
+	w, err := os.OpenFile(out, os.O_WRONLY, 0)
+	if err != nil {
+		return "", fmt.Errorf("cannot prompt without a terminal: %w", err)
+	}
+	defer w.Close()
+	fmt.Fprint(w, prompt)
+	if secret {
+		if restore, err := disableEcho(r); err == nil {
+			defer fmt.Fprintln(w)
+			defer atCleanup(restore)()
+		}
+	}
+	line, err := readLine(ctx, bufio.NewReader(r))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// readLine reads a line from r until ctx is done. The read is left behind
+// when ctx is done first, so r must not be used afterwards.
+func readLine(ctx context.Context, r *bufio.Reader) (string, error) {
+	type result struct {
+		line string
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		line, err := r.ReadString('\n')
+		ch <- result{line, err}
+	}()
+	select {
+	case res := <-ch:
+		return res.line, res.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
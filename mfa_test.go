@@ -0,0 +1,34 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReadLine(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	defer r.Close()
+	br := bufio.NewReader(r)
+
+	w.WriteString("123456\n")
+	line, err := readLine(context.Background(), br)
+	if err != nil || line != "123456\n" {
+		t.Errorf("readLine() = %q, %v, want %q", line, err, "123456\n")
+	}
+
+	// nothing is written, like a prompt waiting for the user
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := readLine(ctx, br); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("readLine() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,14 @@
+// SPDX-License-Identifier: MIT
+//go:build unix
+
+package main
+
+import "syscall"
+
+func mlock(b []byte) error {
+	return syscall.Mlock(b)
+}
+
+func munlock(b []byte) error {
+	return syscall.Munlock(b)
+}
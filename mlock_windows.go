@@ -0,0 +1,27 @@
+// SPDX-License-Identifier: MIT
+//go:build windows
+
+package main
+
+import "unsafe"
+
+var (
+	procVirtualLock   = modkernel32.NewProc("VirtualLock")
+	procVirtualUnlock = modkernel32.NewProc("VirtualUnlock")
+)
+
+func mlock(b []byte) error {
+	r, _, err := procVirtualLock.Call(uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+func munlock(b []byte) error {
+	r, _, err := procVirtualUnlock.Call(uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+// SPDX-License-Identifier: MIT
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// parentProcessName returns the command name of the parent process, or an
+// empty string when it is unknown.
+func parentProcessName() string {
+	b, err := os.ReadFile("/proc/" + strconv.Itoa(os.Getppid()) + "/comm")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
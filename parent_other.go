@@ -0,0 +1,21 @@
+// SPDX-License-Identifier: MIT
+//go:build !linux && !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// parentProcessName returns the command name of the parent process, or an
+// empty string when it is unknown.
+func parentProcessName() string {
+	b, err := exec.Command("ps", "-o", "comm=", "-p", strconv.Itoa(os.Getppid())).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,29 @@
+// SPDX-License-Identifier: MIT
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// parentProcessName returns the executable name of the parent process, or an
+// empty string when it is unknown.
+func parentProcessName() string {
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return ""
+	}
+	defer syscall.CloseHandle(snapshot)
+	var e syscall.ProcessEntry32
+	e.Size = uint32(unsafe.Sizeof(e))
+	ppid := uint32(os.Getppid())
+	for err = syscall.Process32First(snapshot, &e); err == nil; err = syscall.Process32Next(snapshot, &e) {
+		if e.ProcessID == ppid {
+			return syscall.UTF16ToString(e.ExeFile[:])
+		}
+	}
+	return ""
+}
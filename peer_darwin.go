@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: MIT
+//go:build darwin
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	solLocal      = 0
+	localPeerCred = 0x1
+	xucredVersion = 0
+	xucredNGroups = 16
+)
+
+type xucred struct {
+	Version uint32
+	UID     uint32
+	NGroups int16
+	Groups  [xucredNGroups]uint32
+}
+
+// checkPeer refuses connections of the unix socket c from other users, with
+// the credentials of the peer given by LOCAL_PEERCRED.
+func checkPeer(c net.Conn) error {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return nil
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var cred xucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		size := uint32(unsafe.Sizeof(cred))
+		if _, _, errno := syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, solLocal, localPeerCred, uintptr(unsafe.Pointer(&cred)), uintptr(unsafe.Pointer(&size)), 0); errno != 0 {
+			credErr = errno
+		}
+	}); err != nil {
+		return err
+	}
+	if credErr != nil {
+		return credErr
+	}
+	if cred.Version != xucredVersion {
+		return fmt.Errorf("unknown xucred version %d", cred.Version)
+	}
+	if int(cred.UID) != os.Getuid() {
+		return fmt.Errorf("connection of uid %d refused", cred.UID)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+// SPDX-License-Identifier: MIT
+//go:build !linux && !darwin
+
+package main
+
+import "net"
+
+// checkPeer accepts every connection where the credentials of the peer are not
+// available: the socket is only reachable through a private directory.
+func checkPeer(c net.Conn) error {
+	return nil
+}
@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// mkdirPrivate creates dir and its missing parents with mode 0700 regardless
+// of the umask. Existing directories are left as they are.
+func mkdirPrivate(dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := mkdirPrivate(filepath.Dir(dir)); err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, 0o700); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return os.Chmod(dir, 0o700)
+}
+
+// writeFileAtomic replaces name with data through a temporary file in the same
+// directory, so readers never observe a partially written file. The file is
+// created with mode 0600 regardless of the umask. A symlink is kept and its
+// target replaced instead, e.g. for ~/.aws/config managed in a dotfiles
+// repository.
+func writeFileAtomic(name string, data []byte) error {
+	if resolved, err := filepath.EvalSymlinks(name); err == nil {
+		name = resolved
+	} else if target, err := os.Readlink(name); err == nil {
+		// dangling symlink
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(name), target)
+		}
+		name = target
+	}
+	dir := filepath.Dir(name)
+	if err := mkdirPrivate(dir); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer atCleanup(func() { os.Remove(f.Name()) })()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o600); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// checkPermissions warns about files of the tool that other users can read,
+// and fails instead with -strict-permissions.
+func checkPermissions() {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var names []string
+	if name, err := toolConfigFile(); err == nil {
+		names = append(names, name)
+	}
+	if name, err := userDefaultFile(); err == nil {
+		names = append(names, name)
+	}
+	if dir, err := cacheDir(); err == nil {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil {
+				names = append(names, path)
+			}
+			return nil
+		})
+	}
+
+	var insecure []string
+	for _, name := range names {
+		fi, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		if fi.Mode().Perm()&0o077 != 0 {
+			insecure = append(insecure, fmt.Sprintf("%s (%s)", name, fi.Mode().Perm()))
+		}
+	}
+	for _, name := range insecure {
+		if strictPermissions {
+			fatalf("%s is accessible by other users, fix it with chmod go-rwx", name)
+		}
+		log.Printf("warning: %s is accessible by other users, fix it with chmod go-rwx", name)
+	}
+}
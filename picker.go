@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// pickerHeight is the number of candidates shown at once by pick.
+const pickerHeight = 10
+
+// pick lets the user choose one of candidates with a picker on the terminal:
+// typing narrows them down to the ones containing the typed characters in
+// order, arrows or Ctrl+P/Ctrl+N move the selection and Enter chooses it. It
+// falls back to the numbered list of choose when the terminal cannot be put
+// into raw mode.
+func pick(ctx context.Context, what string, candidates []string) (string, error) {
+	if ciMode || !isTerminal(os.Stdin) || !isTerminal(os.Stderr) {
+		return choose(ctx, what, candidates)
+	}
+	restore, err := makeRaw(os.Stdin)
+	if err != nil {
+		return choose(ctx, what, candidates)
+	}
+	defer atCleanup(restore)()
+
+	p := &picker{what: what, candidates: candidates, width: termWidth(os.Stderr)}
+	if p.width <= 0 {
+		p.width = 80
+	}
+	p.filter()
+	defer p.clear()
+	buf := make([]byte, 256)
+	for {
+		p.draw()
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return "", err
+		}
+		switch done, ok := p.key(buf[:n]); {
+		case !done:
+		case ok:
+			return p.matches[p.cursor], nil
+		default:
+			return "", fmt.Errorf("no %s chosen", what)
+		}
+	}
+}
+
+type picker struct {
+	what       string
+	candidates []string
+	query      []rune
+	matches    []string
+	cursor     int
+	top        int // first match shown
+	width      int
+	lines      int // lines drawn above the prompt
+}
+
+func (p *picker) filter() {
+	p.matches = p.matches[:0]
+	for _, c := range p.candidates {
+		if fuzzyMatch(c, string(p.query)) {
+			p.matches = append(p.matches, c)
+		}
+	}
+	p.cursor, p.top = 0, 0
+}
+
+func (p *picker) move(d int) {
+	p.cursor = max(0, min(p.cursor+d, len(p.matches)-1))
+	if p.cursor < p.top {
+		p.top = p.cursor
+	}
+	if p.cursor >= p.top+pickerHeight {
+		p.top = p.cursor - pickerHeight + 1
+	}
+}
+
+// key handles the input b, and reports if the picker is done and whether a
+// candidate was chosen.
+func (p *picker) key(b []byte) (done, ok bool) {
+	switch k := string(b); {
+	case k == "\x1b[A" || k == "\x1bOA" || k == "\x10": // Up, Ctrl+P
+		p.move(-1)
+	case k == "\x1b[B" || k == "\x1bOB" || k == "\x0e": // Down, Ctrl+N
+		p.move(1)
+	case k == "\r" || k == "\n":
+		return len(p.matches) > 0, true
+	case k == "\x03" || k == "\x04" || k == "\x1b": // Ctrl+C, Ctrl+D, Esc
+		return true, false
+	case k == "\x7f" || k == "\b":
+		if len(p.query) > 0 {
+			p.query = p.query[:len(p.query)-1]
+			p.filter()
+		}
+	case k == "\x15": // Ctrl+U
+		p.query = nil
+		p.filter()
+	case b[0] != 0x1b:
+		for _, r := range k {
+			if unicode.IsPrint(r) {
+				p.query = append(p.query, r)
+			}
+		}
+		p.filter()
+	}
+	return false, false
+}
+
+// draw redraws the visible matches above the prompt, leaving the cursor at the
+// end of the query.
+func (p *picker) draw() {
+	var b strings.Builder
+	p.erase(&b)
+	end := min(p.top+pickerHeight, len(p.matches))
+	for i := p.top; i < end; i++ {
+		marker := "  "
+		if i == p.cursor {
+			marker = "> "
+		}
+		b.WriteString(truncate(marker+p.matches[i], p.width-1) + "\r\n")
+	}
+	p.lines = end - p.top
+	fmt.Fprintf(&b, "%d/%d %s: %s", len(p.matches), len(p.candidates), p.what, string(p.query))
+	os.Stderr.WriteString(b.String())
+}
+
+func (p *picker) clear() {
+	var b strings.Builder
+	p.erase(&b)
+	os.Stderr.WriteString(b.String())
+}
+
+func (p *picker) erase(b *strings.Builder) {
+	if p.lines > 0 {
+		fmt.Fprintf(b, "\x1b[%dA", p.lines)
+	}
+	b.WriteString("\r\x1b[J")
+}
+
+// fuzzyMatch reports if s contains the characters of query in order, ignoring
+// case.
+func fuzzyMatch(s, query string) bool {
+	s = strings.ToLower(s)
+	for _, r := range strings.ToLower(query) {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+utf8.RuneLen(r):]
+	}
+	return true
+}
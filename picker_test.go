@@ -0,0 +1,25 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import "testing"
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		s, query string
+		want     bool
+	}{
+		{"prod-admin", "", true},
+		{"prod-admin", "pa", true},
+		{"prod-admin", "PrdAdm", true},
+		{"prod-admin", "ap", false},
+		{"prod-admin", "prod-admins", false},
+		{"arn:aws:iam::123456789012:role/Admin", "1234admin", true},
+		{"dév-ölçü", "DÉVÇ", true},
+		{"dév", "dve", false},
+	}
+	for _, tt := range tests {
+		if got := fuzzyMatch(tt.s, tt.query); got != tt.want {
+			t.Errorf("fuzzyMatch(%q, %q) = %v, want %v", tt.s, tt.query, got, tt.want)
+		}
+	}
+}
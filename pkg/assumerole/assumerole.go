@@ -0,0 +1,297 @@
+// SPDX-License-Identifier: MIT
+
+// Package assumerole assumes IAM roles the way the aws-assume-role command
+// does, for programs that want to embed it instead of running the command: it
+// chains roles, assumes roles with web identity tokens, asks for MFA codes
+// and retries the calls. The command itself assumes every role through it.
+//
+//	p := assumerole.New(sts.NewFromConfig(cfg), func(o *assumerole.Options) {
+//		o.RoleARN = "arn:aws:iam::123456789012:role/Admin"
+//		o.Duration = time.Hour
+//	})
+//	cfg.Credentials = aws.NewCredentialsCache(p)
+//
+// Sessions are kept in memory by aws.NewCredentialsCache, which renews them
+// before they expire. The session cache shared between invocations, the role
+// catalog and the other features of the command stay in the command.
+package assumerole
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// Client is the part of *sts.Client used by Provider. The credentials of the
+// roles of a chain are passed to the calls as an option.
+type Client interface {
+	AssumeRole(ctx context.Context, params *sts.AssumeRoleInput, optFns ...func(*sts.Options)) (*sts.AssumeRoleOutput, error)
+	AssumeRoleWithWebIdentity(ctx context.Context, params *sts.AssumeRoleWithWebIdentityInput, optFns ...func(*sts.Options)) (*sts.AssumeRoleWithWebIdentityOutput, error)
+}
+
+// Hop is an intermediate role of a chain.
+type Hop struct {
+	RoleARN string
+	// RoleSessionName defaults to the one of the options.
+	RoleSessionName string
+	ExternalID      string
+}
+
+// Options are the parameters of the role sessions.
+type Options struct {
+	RoleARN string
+	// RoleSessionName defaults to the current unix nano timestamp.
+	RoleSessionName string
+	// Duration defaults to the default of STS, one hour.
+	Duration       time.Duration
+	ExternalID     string
+	SerialNumber   string
+	SourceIdentity string
+	// TokenCode returns the MFA token code when SerialNumber is set, and is
+	// called for every session.
+	TokenCode         func() (string, error)
+	Tags              []types.Tag
+	TransitiveTagKeys []string
+	PolicyARNs        []string
+	Policy            string
+
+	// WebIdentityToken returns the OIDC token to assume the first role with
+	// sts:AssumeRoleWithWebIdentity instead of the credentials of the client.
+	// Session tags, the source identity, MFA and the external ID do not apply
+	// to that call.
+	WebIdentityToken func() (string, error)
+	ProviderID       string
+
+	// Hops are assumed in order before RoleARN, each with the credentials of
+	// the previous one. The first call of the chain uses MFA, the source
+	// identity and the tags of TransitiveTagKeys, and RoleARN the other tags,
+	// Duration and the session policies. STS limits chained sessions to one
+	// hour.
+	Hops []Hop
+
+	// Retry calls op, the STS operation called name, until it succeeds or
+	// gives up. The client should not retry by itself then. By default op is
+	// called once.
+	Retry func(ctx context.Context, name string, op func(context.Context) error) error
+}
+
+// Provider assumes the role of its options. It satisfies
+// aws.CredentialsProvider, and aws.NewCredentialsCache renews its sessions
+// before they expire.
+type Provider struct {
+	client  Client
+	options Options
+}
+
+// New returns a provider assuming the role with client, which are usually the
+// source credentials.
+func New(client Client, optFns ...func(*Options)) *Provider {
+	p := &Provider{client: client}
+	for _, fn := range optFns {
+		fn(&p.options)
+	}
+	if p.options.RoleSessionName == "" {
+		p.options.RoleSessionName = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	if p.options.Retry == nil {
+		p.options.Retry = func(ctx context.Context, _ string, op func(context.Context) error) error {
+			return op(ctx)
+		}
+	}
+	return p
+}
+
+// Options returns a copy of the options of p.
+func (p *Provider) Options() Options {
+	return p.options
+}
+
+// Assume assumes the hops and the role, and returns the whole output of the
+// last call, for callers that need more than the credentials.
+func (p *Provider) Assume(ctx context.Context) (*sts.AssumeRoleOutput, error) {
+	creds, err := p.AssumeHops(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.AssumeTarget(ctx, creds)
+}
+
+// AssumeHops assumes the Hops and returns the credentials of the last one, or
+// nil without hops.
+func (p *Provider) AssumeHops(ctx context.Context) (aws.CredentialsProvider, error) {
+	var creds aws.CredentialsProvider
+	for i, h := range p.options.Hops {
+		sessionName := h.RoleSessionName
+		if sessionName == "" {
+			sessionName = p.options.RoleSessionName
+		}
+		out, err := p.call(ctx, creds, call{arn: h.RoleARN, sessionName: sessionName, externalID: h.ExternalID, first: i == 0})
+		if err != nil {
+			return nil, err
+		}
+		c := out.Credentials
+		creds = aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(aws.ToString(c.AccessKeyId), aws.ToString(c.SecretAccessKey), aws.ToString(c.SessionToken)))
+	}
+	return creds, nil
+}
+
+// AssumeTarget assumes RoleARN with creds, the credentials returned by
+// AssumeHops, or with the credentials of the client when creds is nil.
+func (p *Provider) AssumeTarget(ctx context.Context, creds aws.CredentialsProvider) (*sts.AssumeRoleOutput, error) {
+	o := p.options
+	return p.call(ctx, creds, call{arn: o.RoleARN, sessionName: o.RoleSessionName, externalID: o.ExternalID, first: len(o.Hops) == 0, last: true})
+}
+
+// Retrieve assumes the role and returns the credentials of the session.
+func (p *Provider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	out, err := p.Assume(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	c := out.Credentials
+	return aws.Credentials{
+		AccessKeyID:     aws.ToString(c.AccessKeyId),
+		SecretAccessKey: aws.ToString(c.SecretAccessKey),
+		SessionToken:    aws.ToString(c.SessionToken),
+		Source:          "aws-assume-role",
+		CanExpire:       true,
+		Expires:         aws.ToTime(c.Expiration),
+	}, nil
+}
+
+// call is a role of the chain: the first one gets the parameters bound to the
+// source of the chain, and the last one those of the final session.
+type call struct {
+	arn         string
+	sessionName string
+	externalID  string
+	first       bool
+	last        bool
+}
+
+func (p *Provider) call(ctx context.Context, creds aws.CredentialsProvider, c call) (*sts.AssumeRoleOutput, error) {
+	o := p.options
+	if c.arn == "" {
+		return nil, errors.New("assumerole: RoleARN is required")
+	}
+	var optFns []func(*sts.Options)
+	if creds != nil {
+		optFns = append(optFns, func(so *sts.Options) { so.Credentials = creds })
+	}
+	if c.first && o.WebIdentityToken != nil {
+		return p.callWithWebIdentity(ctx, c, optFns)
+	}
+
+	in := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(c.arn),
+		RoleSessionName: aws.String(c.sessionName),
+		ExternalId:      optional(c.externalID),
+	}
+	transitive, rest := p.splitTags()
+	if c.first {
+		in.SourceIdentity = optional(o.SourceIdentity)
+		in.Tags = transitive
+		in.TransitiveTagKeys = o.TransitiveTagKeys
+		if o.SerialNumber != "" {
+			if o.TokenCode == nil {
+				return nil, errors.New("assumerole: TokenCode is required with SerialNumber")
+			}
+			code, err := o.TokenCode()
+			if err != nil {
+				return nil, err
+			}
+			in.SerialNumber = aws.String(o.SerialNumber)
+			in.TokenCode = aws.String(code)
+		}
+	}
+	if c.last {
+		in.Tags = append(in.Tags, rest...)
+		in.DurationSeconds = durationSeconds(o.Duration)
+		in.PolicyArns = policyDescriptors(o.PolicyARNs)
+		in.Policy = optional(o.Policy)
+	}
+	var out *sts.AssumeRoleOutput
+	err := o.Retry(ctx, "AssumeRole", func(ctx context.Context) error {
+		var err error
+		out, err = p.client.AssumeRole(ctx, in, optFns...)
+		return err
+	})
+	return out, err
+}
+
+func (p *Provider) callWithWebIdentity(ctx context.Context, c call, optFns []func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	o := p.options
+	token, err := o.WebIdentityToken()
+	if err != nil {
+		return nil, err
+	}
+	in := &sts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          aws.String(c.arn),
+		RoleSessionName:  aws.String(c.sessionName),
+		WebIdentityToken: aws.String(token),
+		ProviderId:       optional(o.ProviderID),
+	}
+	if c.last {
+		in.DurationSeconds = durationSeconds(o.Duration)
+		in.PolicyArns = policyDescriptors(o.PolicyARNs)
+		in.Policy = optional(o.Policy)
+	}
+	var out *sts.AssumeRoleWithWebIdentityOutput
+	err = o.Retry(ctx, "AssumeRoleWithWebIdentity", func(ctx context.Context) error {
+		var err error
+		out, err = p.client.AssumeRoleWithWebIdentity(ctx, in, optFns...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &sts.AssumeRoleOutput{
+		Credentials:      out.Credentials,
+		AssumedRoleUser:  out.AssumedRoleUser,
+		SourceIdentity:   out.SourceIdentity,
+		PackedPolicySize: out.PackedPolicySize,
+	}, nil
+}
+
+// splitTags separates the tags of TransitiveTagKeys, which are set on the
+// first call of a chain to be passed along, from the others.
+func (p *Provider) splitTags() (transitive, rest []types.Tag) {
+	for _, t := range p.options.Tags {
+		if slices.ContainsFunc(p.options.TransitiveTagKeys, func(k string) bool { return strings.EqualFold(k, aws.ToString(t.Key)) }) {
+			transitive = append(transitive, t)
+		} else {
+			rest = append(rest, t)
+		}
+	}
+	return transitive, rest
+}
+
+func durationSeconds(d time.Duration) *int32 {
+	if d <= 0 {
+		return nil
+	}
+	return aws.Int32(int32(d.Seconds()))
+}
+
+func policyDescriptors(arns []string) []types.PolicyDescriptorType {
+	var descriptors []types.PolicyDescriptorType
+	for _, arn := range arns {
+		descriptors = append(descriptors, types.PolicyDescriptorType{Arn: aws.String(arn)})
+	}
+	return descriptors
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,230 @@
+// SPDX-License-Identifier: MIT
+package assumerole
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// stubClient records the calls and returns credentials named after the role.
+type stubClient struct {
+	calls    []*sts.AssumeRoleInput
+	webCalls []*sts.AssumeRoleWithWebIdentityInput
+	creds    []aws.CredentialsProvider
+	err      error
+}
+
+func (c *stubClient) output(arn string) *types.Credentials {
+	return &types.Credentials{
+		AccessKeyId:     aws.String("AKID " + arn),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)),
+	}
+}
+
+func (c *stubClient) credentials(optFns []func(*sts.Options)) {
+	var o sts.Options
+	for _, fn := range optFns {
+		fn(&o)
+	}
+	c.creds = append(c.creds, o.Credentials)
+}
+
+func (c *stubClient) AssumeRole(ctx context.Context, in *sts.AssumeRoleInput, optFns ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	c.calls = append(c.calls, in)
+	c.credentials(optFns)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &sts.AssumeRoleOutput{Credentials: c.output(*in.RoleArn)}, nil
+}
+
+func (c *stubClient) AssumeRoleWithWebIdentity(ctx context.Context, in *sts.AssumeRoleWithWebIdentityInput, optFns ...func(*sts.Options)) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+	c.webCalls = append(c.webCalls, in)
+	c.credentials(optFns)
+	return &sts.AssumeRoleWithWebIdentityOutput{Credentials: c.output(*in.RoleArn)}, nil
+}
+
+func tag(k string) types.Tag {
+	return types.Tag{Key: aws.String(k), Value: aws.String("v")}
+}
+
+func tagKeys(tags []types.Tag) []string {
+	var keys []string
+	for _, t := range tags {
+		keys = append(keys, *t.Key)
+	}
+	return keys
+}
+
+func TestRetrieve(t *testing.T) {
+	client := &stubClient{}
+	p := New(client, func(o *Options) {
+		o.RoleARN = "arn:aws:iam::123456789012:role/Admin"
+		o.RoleSessionName = "session"
+		o.Duration = 2 * time.Hour
+		o.ExternalID = "external"
+		o.SerialNumber = "arn:aws:iam::123456789012:mfa/user"
+		o.TokenCode = func() (string, error) { return "123456", nil }
+		o.PolicyARNs = []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"}
+	})
+	creds, err := p.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := aws.Credentials{
+		AccessKeyID:     "AKID arn:aws:iam::123456789012:role/Admin",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Source:          "aws-assume-role",
+		CanExpire:       true,
+		Expires:         time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if creds != want {
+		t.Errorf("Retrieve() = %+v, want %+v", creds, want)
+	}
+	if len(client.calls) != 1 {
+		t.Fatalf("got %d calls, want 1", len(client.calls))
+	}
+	in := client.calls[0]
+	if aws.ToString(in.RoleSessionName) != "session" || aws.ToInt32(in.DurationSeconds) != 7200 || aws.ToString(in.ExternalId) != "external" {
+		t.Errorf("unexpected input %+v", in)
+	}
+	if aws.ToString(in.SerialNumber) != "arn:aws:iam::123456789012:mfa/user" || aws.ToString(in.TokenCode) != "123456" {
+		t.Errorf("MFA = %v %v", aws.ToString(in.SerialNumber), aws.ToString(in.TokenCode))
+	}
+	if len(in.PolicyArns) != 1 || in.SourceIdentity != nil || in.Policy != nil {
+		t.Errorf("unexpected input %+v", in)
+	}
+	if client.creds[0] != nil {
+		t.Error("the first call must use the credentials of the client")
+	}
+}
+
+func TestRetrieveErrors(t *testing.T) {
+	if _, err := New(&stubClient{}).Retrieve(context.Background()); err == nil {
+		t.Error("Retrieve() without RoleARN succeeded")
+	}
+	p := New(&stubClient{}, func(o *Options) {
+		o.RoleARN = "arn:aws:iam::123456789012:role/Admin"
+		o.SerialNumber = "arn:aws:iam::123456789012:mfa/user"
+	})
+	if _, err := p.Retrieve(context.Background()); err == nil {
+		t.Error("Retrieve() with SerialNumber and without TokenCode succeeded")
+	}
+	errDenied := errors.New("denied")
+	p = New(&stubClient{err: errDenied}, func(o *Options) {
+		o.RoleARN = "arn:aws:iam::123456789012:role/Admin"
+	})
+	if _, err := p.Retrieve(context.Background()); !errors.Is(err, errDenied) {
+		t.Errorf("Retrieve() = %v, want %v", err, errDenied)
+	}
+}
+
+func TestRetrieveHops(t *testing.T) {
+	client := &stubClient{}
+	p := New(client, func(o *Options) {
+		o.Hops = []Hop{
+			{RoleARN: "arn:aws:iam::111111111111:role/Hop1", ExternalID: "hop1"},
+			{RoleARN: "arn:aws:iam::222222222222:role/Hop2", RoleSessionName: "hop2"},
+		}
+		o.RoleARN = "arn:aws:iam::333333333333:role/Target"
+		o.RoleSessionName = "session"
+		o.Duration = time.Hour
+		o.SerialNumber = "arn:aws:iam::123456789012:mfa/user"
+		o.TokenCode = func() (string, error) { return "123456", nil }
+		o.SourceIdentity = "user"
+		o.Tags = []types.Tag{tag("Project"), tag("Team")}
+		o.TransitiveTagKeys = []string{"team"}
+		o.Policy = `{"Version":"2012-10-17"}`
+	})
+	creds, err := p.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "AKID arn:aws:iam::333333333333:role/Target" {
+		t.Errorf("AccessKeyID = %q", creds.AccessKeyID)
+	}
+	if len(client.calls) != 3 {
+		t.Fatalf("got %d calls, want 3", len(client.calls))
+	}
+	first, second, last := client.calls[0], client.calls[1], client.calls[2]
+	if aws.ToString(first.ExternalId) != "hop1" || aws.ToString(first.RoleSessionName) != "session" || aws.ToString(second.RoleSessionName) != "hop2" {
+		t.Errorf("unexpected hops %+v %+v", first, second)
+	}
+	if aws.ToString(first.TokenCode) != "123456" || aws.ToString(first.SourceIdentity) != "user" || second.TokenCode != nil || last.TokenCode != nil {
+		t.Error("MFA and the source identity must only be used by the first call")
+	}
+	if got := tagKeys(first.Tags); len(got) != 1 || got[0] != "Team" || len(first.TransitiveTagKeys) != 1 {
+		t.Errorf("first tags = %v", got)
+	}
+	if got := tagKeys(last.Tags); len(got) != 1 || got[0] != "Project" || last.TransitiveTagKeys != nil {
+		t.Errorf("last tags = %v", got)
+	}
+	if first.DurationSeconds != nil || first.Policy != nil || aws.ToInt32(last.DurationSeconds) != 3600 || last.Policy == nil {
+		t.Error("the duration and the session policies must only be used by the last call")
+	}
+	if client.creds[0] != nil {
+		t.Error("the first hop must use the credentials of the client")
+	}
+	for i, arn := range []string{"arn:aws:iam::111111111111:role/Hop1", "arn:aws:iam::222222222222:role/Hop2"} {
+		c, err := client.creds[i+1].Retrieve(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.AccessKeyID != "AKID "+arn {
+			t.Errorf("call %d used %q, want the credentials of %s", i+1, c.AccessKeyID, arn)
+		}
+	}
+}
+
+func TestRetrieveWebIdentity(t *testing.T) {
+	client := &stubClient{}
+	p := New(client, func(o *Options) {
+		o.Hops = []Hop{{RoleARN: "arn:aws:iam::111111111111:role/Hop"}}
+		o.RoleARN = "arn:aws:iam::222222222222:role/Target"
+		o.WebIdentityToken = func() (string, error) { return "jwt", nil }
+		o.ProviderID = "provider"
+	})
+	if _, err := p.Retrieve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.webCalls) != 1 || len(client.calls) != 1 {
+		t.Fatalf("got %d web identity calls and %d AssumeRole calls, want 1 and 1", len(client.webCalls), len(client.calls))
+	}
+	in := client.webCalls[0]
+	if aws.ToString(in.RoleArn) != "arn:aws:iam::111111111111:role/Hop" || aws.ToString(in.WebIdentityToken) != "jwt" || aws.ToString(in.ProviderId) != "provider" {
+		t.Errorf("unexpected input %+v", in)
+	}
+	if aws.ToString(client.calls[0].RoleArn) != "arn:aws:iam::222222222222:role/Target" {
+		t.Errorf("RoleArn = %q", aws.ToString(client.calls[0].RoleArn))
+	}
+}
+
+func TestRetrieveRetry(t *testing.T) {
+	var names []string
+	client := &stubClient{}
+	p := New(client, func(o *Options) {
+		o.RoleARN = "arn:aws:iam::123456789012:role/Admin"
+		o.Retry = func(ctx context.Context, name string, op func(context.Context) error) error {
+			names = append(names, name)
+			if err := op(ctx); err != nil {
+				return err
+			}
+			return op(ctx)
+		}
+	})
+	if _, err := p.Retrieve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "AssumeRole" || len(client.calls) != 2 {
+		t.Errorf("Retry called with %v and %d calls, want [AssumeRole] and 2", names, len(client.calls))
+	}
+}
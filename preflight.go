@@ -0,0 +1,367 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+type trustStatement struct {
+	Sid       string
+	Effect    string
+	Principal any
+	Action    any
+	Condition map[string]map[string]any
+}
+
+// caller describes the source credentials as seen by IAM.
+type caller struct {
+	arn     string
+	account string
+	// kind and name, e.g. "role" and "Admin" for an assumed role session
+	kind string
+	name string
+}
+
+func newCaller(arn string) (*caller, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return nil, fmt.Errorf("invalid arn: %s", arn)
+	}
+	c := &caller{arn: arn, account: parts[4]}
+	resource := strings.Split(parts[5], "/")
+	switch resource[0] {
+	case "assumed-role":
+		c.kind, c.name = "role", resource[1]
+	case "user":
+		c.kind, c.name = "user", resource[len(resource)-1]
+	default:
+		c.kind, c.name = resource[0], resource[len(resource)-1]
+	}
+	return c, nil
+}
+
+// principalArn is the aws:PrincipalArn of the caller. Paths of roles are not
+// known from an assumed role session, so they are omitted.
+func (c *caller) principalArn() string {
+	if c.kind == "role" {
+		partition := strings.SplitN(c.arn, ":", 3)[1]
+		return "arn:" + partition + ":iam::" + c.account + ":role/" + c.name
+	}
+	return c.arn
+}
+
+// trusts reports if the AWS principal p of a trust policy refers to the caller.
+func (c *caller) trusts(p string) bool {
+	if p == "*" || p == c.account || p == c.arn {
+		return true
+	}
+	parts := strings.SplitN(p, ":", 6)
+	if len(parts) != 6 || parts[4] != c.account {
+		return false
+	}
+	if parts[5] == "root" {
+		return true
+	}
+	resource := strings.Split(parts[5], "/")
+	return resource[0] == c.kind && resource[len(resource)-1] == c.name
+}
+
+// preflight reads the trust policy of the role and explains why the caller
+// cannot assume it, before STS answers with a bare AccessDenied.
+func preflight(ctx context.Context, cfg aws.Config) error {
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("preflight: %w", err)
+	}
+	c, err := newCaller(*identity.Arn)
+	if err != nil {
+		return fmt.Errorf("preflight: %w", err)
+	}
+	name, err := localRoleName(roleArn, c.account)
+	if err != nil {
+		log.Printf("preflight: skipped, cannot read the trust policy of %s: %v", roleArn, err)
+		return nil
+	}
+	out, err := iam.NewFromConfig(cfg).GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(name)})
+	if err == nil && aws.ToString(out.Role.Arn) != roleArn {
+		err = fmt.Errorf("the role %s of the account has another path", aws.ToString(out.Role.Arn))
+	}
+	if err != nil {
+		log.Printf("preflight: skipped, cannot read the trust policy of %s: %v", roleArn, err)
+		return nil
+	}
+	statements, err := parseTrustPolicy(aws.ToString(out.Role.AssumeRolePolicyDocument))
+	if err != nil {
+		return fmt.Errorf("preflight: %w", err)
+	}
+
+	actions := []string{"sts:AssumeRole"}
+	if len(sessionTags) > 0 {
+		actions = append(actions, "sts:TagSession")
+	}
+	if sourceIdentity != "" {
+		actions = append(actions, "sts:SetSourceIdentity")
+	}
+	var reasons []string
+	for _, action := range actions {
+		allowed, r := evaluateTrustPolicy(statements, c, action)
+		if !allowed {
+			reasons = append(reasons, r...)
+		}
+	}
+	if len(reasons) > 0 {
+		return fmt.Errorf("preflight: the trust policy of %s does not allow %s:\n  - %s", roleArn, c.arn, strings.Join(reasons, "\n  - "))
+	}
+	return nil
+}
+
+// localRoleName returns the name of the role arn, like Deploy for
+// arn:aws:iam::111111111111:role/ci/Deploy, when it is a role of account. IAM
+// only reads the roles of the account of the credentials, and a role of the
+// same name elsewhere is another role.
+func localRoleName(arn, account string) (string, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || !strings.HasPrefix(parts[5], "role/") {
+		return "", fmt.Errorf("invalid role arn: %s", arn)
+	}
+	if parts[4] != account {
+		return "", fmt.Errorf("the role is in account %s, not in the account of the source credentials (%s)", parts[4], account)
+	}
+	return parts[5][strings.LastIndex(parts[5], "/")+1:], nil
+}
+
+// parseTrustPolicy parses the URL encoded trust policy returned by IAM.
+func parseTrustPolicy(encoded string) ([]trustStatement, error) {
+	doc, err := url.QueryUnescape(encoded)
+	if err != nil {
+		return nil, err
+	}
+	var p struct {
+		Statement json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(doc), &p); err != nil {
+		return nil, fmt.Errorf("invalid trust policy: %w", err)
+	}
+	var statements []trustStatement
+	if err := json.Unmarshal(p.Statement, &statements); err != nil {
+		var s trustStatement
+		if err := json.Unmarshal(p.Statement, &s); err != nil {
+			return nil, fmt.Errorf("invalid trust policy: %w", err)
+		}
+		statements = []trustStatement{s}
+	}
+	return statements, nil
+}
+
+// evaluateTrustPolicy reports if a statement allows the caller to perform
+// action on the role and none denies it, or the reasons why not. Conditions
+// on keys that are not known locally are assumed to match in Allow statements
+// and not to match in Deny statements, so only certain failures are reported.
+func evaluateTrustPolicy(statements []trustStatement, c *caller, action string) (bool, []string) {
+	var (
+		reasons []string
+		allowed bool
+	)
+	for i, s := range statements {
+		name := "statement " + strconv.Itoa(i+1)
+		if s.Sid != "" {
+			name += " (" + s.Sid + ")"
+		}
+		if !matchesAny(stringList(s.Action), action, false) {
+			if s.Effect == "Allow" {
+				reasons = append(reasons, fmt.Sprintf("%s does not allow %s", name, action))
+			}
+			continue
+		}
+		principals := principalList(s.Principal)
+		trusted := false
+		for _, p := range principals {
+			trusted = trusted || c.trusts(p)
+		}
+		if !trusted {
+			switch {
+			case s.Effect != "Allow":
+			case len(principals) == 0:
+				reasons = append(reasons, fmt.Sprintf("%s only trusts service or federated principals", name))
+			default:
+				reasons = append(reasons, fmt.Sprintf("%s trusts %s, not %s", name, strings.Join(principals, ", "), c.principalArn()))
+			}
+			continue
+		}
+		failed, unknown := evaluateConditions(s.Condition, c)
+		switch {
+		case s.Effect == "Deny" && len(failed) == 0 && !unknown:
+			return false, []string{fmt.Sprintf("%s denies %s", name, action)}
+		case s.Effect == "Allow" && len(failed) == 0:
+			allowed = true
+		case s.Effect == "Allow":
+			reasons = append(reasons, fmt.Sprintf("%s requires %s", name, strings.Join(failed, " and ")))
+		}
+	}
+	if allowed {
+		return true, nil
+	}
+	if len(reasons) == 0 {
+		reasons = []string{"no statement allows " + action}
+	}
+	return false, reasons
+}
+
+// evaluateConditions returns the conditions that the request does not meet,
+// and whether some could not be evaluated.
+func evaluateConditions(conditions map[string]map[string]any, c *caller) ([]string, bool) {
+	known := map[string]string{
+		"aws:principalaccount": c.account,
+	}
+	if c.kind != "role" {
+		// the path of an assumed role is not known
+		known["aws:principalarn"] = c.principalArn()
+	}
+	if externalID != "" {
+		known["sts:externalid"] = externalID
+	}
+	if sourceIdentity != "" {
+		known["sts:sourceidentity"] = sourceIdentity
+	}
+	if roleSessionName != "" {
+		known["sts:rolesessionname"] = roleSessionName
+	}
+	if serialNumber != "" && tokenCode != "" {
+		// without, the source credentials may still be an MFA session
+		known["aws:multifactorauthpresent"] = "true"
+	}
+	for _, t := range sessionTags {
+		known["aws:requesttag/"+strings.ToLower(aws.ToString(t.Key))] = aws.ToString(t.Value)
+	}
+	// the keys set by flags are known to be absent without them
+	checkable := func(key string) bool {
+		if _, ok := known[key]; ok || strings.HasPrefix(key, "aws:requesttag/") {
+			return true
+		}
+		switch key {
+		case "sts:externalid", "sts:sourceidentity", "sts:rolesessionname":
+			return true
+		}
+		return false
+	}
+
+	var (
+		failed  []string
+		unknown bool
+	)
+	for op, keys := range conditions {
+		baseOp, ifExists := strings.CutSuffix(op, "IfExists")
+		for key, want := range keys {
+			k := strings.ToLower(key)
+			if !checkable(k) {
+				unknown = true
+				continue
+			}
+			v, present := known[k]
+			values := stringList(want)
+			var ok bool
+			switch baseOp {
+			case "StringEquals":
+				ok = present && matchesExact(values, v, false)
+			case "StringEqualsIgnoreCase":
+				ok = present && matchesExact(values, v, true)
+			case "StringLike":
+				ok = present && matchesAny(values, v, true)
+			case "ArnLike", "ArnEquals":
+				ok = present && matchesAny(values, v, false)
+			case "StringNotEquals":
+				ok = !present || !matchesExact(values, v, false)
+			case "StringNotLike":
+				ok = !present || !matchesAny(values, v, true)
+			case "ArnNotLike", "ArnNotEquals":
+				ok = !present || !matchesAny(values, v, false)
+			case "Bool":
+				ok = present && matchesExact(values, v, true)
+			case "Null":
+				ok = matchesExact(values, strconv.FormatBool(!present), true)
+			default:
+				unknown = true
+				continue
+			}
+			if !ok && !(ifExists && !present) {
+				failed = append(failed, describeCondition(baseOp, key, values))
+			}
+		}
+	}
+	slices.Sort(failed)
+	return failed, unknown
+}
+
+// describeCondition explains a condition with the flag satisfying it.
+func describeCondition(op, key string, values []string) string {
+	hint := map[string]string{
+		"sts:externalid":      " (-external-id)",
+		"sts:sourceidentity":  " (-source-identity)",
+		"sts:rolesessionname": " (-role-session-name)",
+	}[strings.ToLower(key)]
+	return fmt.Sprintf("%s %s %s%s", key, op, strings.Join(values, "|"), hint)
+}
+
+func matchesExact(values []string, v string, ignoreCase bool) bool {
+	for _, want := range values {
+		if want == v || ignoreCase && strings.EqualFold(want, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny matches v against IAM wildcard patterns, like StringLike when
+// caseSensitive and like actions and ARNs otherwise.
+func matchesAny(patterns []string, v string, caseSensitive bool) bool {
+	flags := "(?i)"
+	if caseSensitive {
+		flags = ""
+	}
+	for _, p := range patterns {
+		re := flags + "^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(p)) + "$"
+		if regexp.MustCompile(re).MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// principalList returns the AWS principals of a statement.
+func principalList(p any) []string {
+	switch p := p.(type) {
+	case string:
+		return []string{p}
+	case map[string]any:
+		return stringList(p["AWS"])
+	}
+	return nil
+}
+
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case bool:
+		return []string{strconv.FormatBool(v)}
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, e := range v {
+			list = append(list, fmt.Sprint(e))
+		}
+		return list
+	}
+	return nil
+}
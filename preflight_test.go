@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestEvaluateTrustPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		externalID string
+		action     string
+		allowed    bool
+		reasons    []string
+	}{
+		{
+			name:    "account root",
+			policy:  `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:root"},"Action":"sts:AssumeRole"}]}`,
+			allowed: true,
+		},
+		{
+			name:    "role with a path",
+			policy:  `{"Statement":[{"Effect":"Allow","Principal":{"AWS":["arn:aws:iam::123456789012:role/team/Dev"]},"Action":["sts:AssumeRole","sts:TagSession"]}]}`,
+			allowed: true,
+		},
+		{
+			name:    "other account",
+			policy:  `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::999999999999:root"},"Action":"sts:AssumeRole"}]}`,
+			reasons: []string{"statement 1 trusts arn:aws:iam::999999999999:root, not arn:aws:iam::123456789012:role/Dev"},
+		},
+		{
+			name:    "service principal",
+			policy:  `{"Statement":[{"Sid":"EC2","Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`,
+			reasons: []string{"statement 1 (EC2) only trusts service or federated principals"},
+		},
+		{
+			name:    "action wildcard",
+			policy:  `{"Statement":[{"Effect":"Allow","Principal":"*","Action":"sts:Assume*"}]}`,
+			action:  "sts:TagSession",
+			reasons: []string{"statement 1 does not allow sts:TagSession"},
+		},
+		{
+			name:    "missing external ID",
+			policy:  `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"123456789012"},"Action":"sts:AssumeRole","Condition":{"StringEquals":{"sts:ExternalId":"secret"}}}]}`,
+			reasons: []string{"statement 1 requires sts:ExternalId StringEquals secret (-external-id)"},
+		},
+		{
+			name:       "external ID",
+			policy:     `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"123456789012"},"Action":"sts:AssumeRole","Condition":{"StringEquals":{"sts:ExternalId":"secret"}}}]}`,
+			externalID: "secret",
+			allowed:    true,
+		},
+		{
+			name:    "unknown condition key",
+			policy:  `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"123456789012"},"Action":"sts:AssumeRole","Condition":{"IpAddress":{"aws:SourceIp":"192.0.2.0/24"}}}]}`,
+			allowed: true,
+		},
+		{
+			name:    "deny",
+			policy:  `{"Statement":[{"Sid":"NoDev","Effect":"Deny","Principal":{"AWS":"arn:aws:iam::123456789012:role/Dev"},"Action":"sts:AssumeRole"},{"Effect":"Allow","Principal":{"AWS":"123456789012"},"Action":"sts:AssumeRole"}]}`,
+			reasons: []string{"statement 1 (NoDev) denies sts:AssumeRole"},
+		},
+		{
+			name:    "deny after allow",
+			policy:  `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"123456789012"},"Action":"sts:AssumeRole"},{"Sid":"NoDev","Effect":"Deny","Principal":"*","Action":"sts:*"}]}`,
+			reasons: []string{"statement 2 (NoDev) denies sts:AssumeRole"},
+		},
+		{
+			name:    "deny on an unknown condition",
+			policy:  `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"123456789012"},"Action":"sts:AssumeRole"},{"Effect":"Deny","Principal":"*","Action":"sts:AssumeRole","Condition":{"BoolIfExists":{"aws:MultiFactorAuthPresent":"false"}}}]}`,
+			allowed: true,
+		},
+		{
+			name:    "principal ARN of a role with a path",
+			policy:  `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"123456789012"},"Action":"sts:AssumeRole","Condition":{"ArnLike":{"aws:PrincipalArn":"arn:aws:iam::123456789012:role/team/*"}}}]}`,
+			allowed: true,
+		},
+		{
+			name:    "MFA from the source credentials",
+			policy:  `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"123456789012"},"Action":"sts:AssumeRole","Condition":{"Bool":{"aws:MultiFactorAuthPresent":"true"}}}]}`,
+			allowed: true,
+		},
+		{
+			name:       "case-sensitive StringLike",
+			policy:     `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"123456789012"},"Action":"sts:AssumeRole","Condition":{"StringLike":{"sts:ExternalId":"Team-*"}}}]}`,
+			externalID: "team-1",
+			reasons:    []string{"statement 1 requires sts:ExternalId StringLike Team-* (-external-id)"},
+		},
+		{
+			name:    "no statement",
+			policy:  `{"Statement":[]}`,
+			reasons: []string{"no statement allows sts:AssumeRole"},
+		},
+	}
+	c, err := newCaller("arn:aws:sts::123456789012:assumed-role/Dev/session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := externalID
+	t.Cleanup(func() { externalID = saved })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			externalID = tt.externalID
+			statements, err := parseTrustPolicy(url.QueryEscape(tt.policy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			action := tt.action
+			if action == "" {
+				action = "sts:AssumeRole"
+			}
+			allowed, reasons := evaluateTrustPolicy(statements, c, action)
+			if allowed != tt.allowed || !slices.Equal(reasons, tt.reasons) {
+				t.Errorf("evaluateTrustPolicy() = %v, %q, want %v, %q", allowed, reasons, tt.allowed, tt.reasons)
+			}
+		})
+	}
+}
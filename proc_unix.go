@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: MIT
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// newCommand runs args in its own process group when the wrapper is not
+// attached to a terminal, so forwarded signals also reach its children. With a
+// terminal the child stays in the foreground process group to keep reading
+// from it and to receive the signals of the terminal itself.
+func newCommand(args []string) (*exec.Cmd, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	if !isTerminal(os.Stdin) {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+	return cmd, nil
+}
+
+// forwardSignals delivers SIGINT, SIGTERM and SIGHUP received by the wrapper
+// to the started cmd, to its process group when it has one (including the
+// session of -tty), until stop is called. SIGINT is left to the terminal when the child shares its process
+// group, since Ctrl+C already reached it.
+func forwardSignals(cmd *exec.Cmd) (stop func()) {
+	group := cmd.SysProcAttr != nil && (cmd.SysProcAttr.Setpgid || cmd.SysProcAttr.Setsid)
+	sigs := make(chan os.Signal, 8)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-sigs:
+				s := sig.(syscall.Signal)
+				switch {
+				case group:
+					syscall.Kill(-cmd.Process.Pid, s)
+				case s != syscall.SIGINT:
+					syscall.Kill(cmd.Process.Pid, s)
+				}
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+// exitCode returns the exit code of the finished command, 128+n when it was
+// killed by signal n like shells do.
+func exitCode(state *os.ProcessState) int {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return state.ExitCode()
+}
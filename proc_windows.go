@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: MIT
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procCreateJobObjectW         = modkernel32.NewProc("CreateJobObjectW")
+	procSetInformationJobObject  = modkernel32.NewProc("SetInformationJobObject")
+	procAssignProcessToJobObject = modkernel32.NewProc("AssignProcessToJobObject")
+)
+
+// batchMetacharacters cannot be passed safely to batch files through cmd.exe.
+const batchMetacharacters = "\"&|<>^%!()\r\n"
+
+const (
+	jobObjectExtendedLimitInformationClass = 9
+	jobObjectLimitKillOnJobClose           = 0x2000
+)
+
+type jobObjectBasicLimitInformation struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+}
+
+type ioCounters struct {
+	ReadOperationCount  uint64
+	WriteOperationCount uint64
+	OtherOperationCount uint64
+	ReadTransferCount   uint64
+	WriteTransferCount  uint64
+	OtherTransferCount  uint64
+}
+
+type jobObjectExtendedLimitInformation struct {
+	BasicLimitInformation jobObjectBasicLimitInformation
+	IoInfo                ioCounters
+	ProcessMemoryLimit    uintptr
+	JobMemoryLimit        uintptr
+	PeakProcessMemoryUsed uintptr
+	PeakJobMemoryUsed     uintptr
+}
+
+// newCommand resolves args[0] through PATH and PATHEXT, and runs batch files
+// through cmd.exe since CreateProcess does not quote their arguments. cmd.exe
+// interprets its metacharacters even in quoted arguments, so arguments of
+// batch files containing them are refused like os/exec does.
+//
+// Signals are not forwarded: Ctrl+C and Ctrl+Break are delivered to every
+// process of the console, so the child handles them itself while the wrapper
+// keeps waiting for it. Instead the wrapper puts itself into a job object that
+// kills the whole process tree when the wrapper goes away.
+func newCommand(args []string) (*exec.Cmd, error) {
+	if err := killTreeOnExit(); err != nil {
+		log.Printf("warning: children may outlive the wrapper: %v", err)
+	}
+
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".bat", ".cmd":
+		comspec := os.Getenv("COMSPEC")
+		if comspec == "" {
+			comspec = "cmd.exe"
+		}
+		quoted := make([]string, 0, len(args))
+		quoted = append(quoted, syscall.EscapeArg(path))
+		for _, a := range args[1:] {
+			if i := strings.IndexAny(a, batchMetacharacters); i >= 0 {
+				return nil, fmt.Errorf("argument %q of batch file %s contains %q, which cmd.exe would interpret", a, path, a[i])
+			}
+			quoted = append(quoted, syscall.EscapeArg(a))
+		}
+		cmd := exec.Command(comspec)
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			CmdLine: syscall.EscapeArg(comspec) + ` /d /s /c "` + strings.Join(quoted, " ") + `"`,
+		}
+		return cmd, nil
+	}
+	return exec.Command(path, args[1:]...), nil
+}
+
+// killTreeOnExit assigns the current process to a job object with
+// JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE. Children inherit the job, and the job is
+// closed by the OS when the wrapper exits for any reason.
+func killTreeOnExit() error {
+	job, _, err := procCreateJobObjectW.Call(0, 0)
+	if job == 0 {
+		return err
+	}
+	var info jobObjectExtendedLimitInformation
+	info.BasicLimitInformation.LimitFlags = jobObjectLimitKillOnJobClose
+	r, _, err := procSetInformationJobObject.Call(
+		job,
+		jobObjectExtendedLimitInformationClass,
+		uintptr(unsafe.Pointer(&info)),
+		unsafe.Sizeof(info),
+	)
+	if r == 0 {
+		syscall.CloseHandle(syscall.Handle(job))
+		return err
+	}
+	self, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return err
+	}
+	r, _, err = procAssignProcessToJobObject.Call(job, uintptr(self))
+	if r == 0 {
+		syscall.CloseHandle(syscall.Handle(job))
+		return err
+	}
+	// the handle is intentionally kept open until the process exits
+	return nil
+}
+
+func forwardSignals(cmd *exec.Cmd) (stop func()) {
+	return func() {}
+}
+
+func exitCode(state *os.ProcessState) int {
+	return state.ExitCode()
+}
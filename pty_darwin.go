@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: MIT
+//go:build darwin
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	ioctlGetTermios = syscall.TIOCGETA
+	ioctlSetTermios = syscall.TIOCSETA
+)
+
+// openPTY opens the master of a new pseudo-terminal from /dev/ptmx and the
+// slave named by TIOCPTYGNAME.
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	name := make([]byte, 128)
+	for _, req := range []struct{ req, arg uintptr }{
+		{syscall.TIOCPTYGRANT, 0},
+		{syscall.TIOCPTYUNLK, 0},
+		{syscall.TIOCPTYGNAME, uintptr(unsafe.Pointer(&name[0]))},
+	} {
+		if err := ioctl(master.Fd(), req.req, req.arg); err != nil {
+			master.Close()
+			return nil, nil, err
+		}
+	}
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	slave, err = os.OpenFile(string(name), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func cacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "aws-assume-role"), nil
+}
+
+// acquireLock waits until the exclusive lock on name is held or ctx is done.
+// Locks are advisory and released by the OS when the process exits.
+func acquireLock(ctx context.Context, name string) (func(), error) {
+	if err := mkdirPrivate(filepath.Dir(name)); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	// the lock is polled, since blocking in the OS cannot be interrupted
+	for wait := 10 * time.Millisecond; ; wait = min(wait*2, 500*time.Millisecond) {
+		ok, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// acquireSTSSlot coordinates AssumeRole calls of concurrent invocations on the
+// machine. Calls for the same role are serialized, and calls for all roles are
+// limited to rateLimit per second, unless shared reports that the result of a
+// concurrent invocation can be used once the lock is held. The returned
+// function must be called after the call completes.
+func acquireSTSSlot(ctx context.Context, target string, shared func() bool) (func(), error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(target))
+	release, err := acquireLock(ctx, filepath.Join(dir, "locks", hex.EncodeToString(sum[:])+".lock"))
+	if err != nil {
+		return nil, err
+	}
+	if rateLimit <= 0 || shared() {
+		return release, nil
+	}
+	if err := waitRateLimit(ctx, dir); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// waitRateLimit records the call in a shared sliding window of one second,
+// sleeping first when the window is full.
+func waitRateLimit(ctx context.Context, dir string) error {
+	unlock, err := acquireLock(ctx, filepath.Join(dir, "ratelimit.lock"))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	name := filepath.Join(dir, "ratelimit")
+	b, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	now := time.Now()
+	var calls []time.Time
+	for _, l := range strings.Fields(string(b)) {
+		n, err := strconv.ParseInt(l, 10, 64)
+		if err != nil {
+			continue
+		}
+		if t := time.Unix(0, n); now.Sub(t) < time.Second {
+			calls = append(calls, t)
+		}
+	}
+	if len(calls) >= rateLimit {
+		wait := calls[len(calls)-rateLimit].Add(time.Second).Sub(now)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		now = time.Now()
+	}
+
+	var sb strings.Builder
+	for _, t := range append(calls, now) {
+		if now.Sub(t) < time.Second {
+			sb.WriteString(strconv.FormatInt(t.UnixNano(), 10) + "\n")
+		}
+	}
+	return writeFileAtomic(name, []byte(sb.String()))
+}
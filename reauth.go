@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	ssotypes "github.com/aws/aws-sdk-go-v2/service/sso/types"
+)
+
+// isSSOSessionExpired reports if the source credentials failed because the
+// cached IAM Identity Center token expired or was revoked.
+func isSSOSessionExpired(err error) bool {
+	var invalid *ssocreds.InvalidTokenError
+	var unauthorized *ssotypes.UnauthorizedException
+	return errors.As(err, &invalid) || errors.As(err, &unauthorized)
+}
+
+// sharedConfigProfile returns the profile of the shared config used by cfg.
+func sharedConfigProfile(cfg aws.Config) string {
+	for _, s := range cfg.ConfigSources {
+		if sc, ok := s.(config.SharedConfig); ok {
+			return sc.Profile
+		}
+	}
+	return ""
+}
+
+// reauthenticate logs in to the portal of -sso-start-url again, or runs the
+// browser login of the AWS CLI for the profile of cfg. Its output goes to
+// stderr to keep stdout for credentials.
+func reauthenticate(ctx context.Context, cfg aws.Config) error {
+	if ssoStartURL != "" {
+		_, err := ssoLogin(ctx, cfg)
+		return err
+	}
+	profile := sharedConfigProfile(cfg)
+	requireInteraction("the SSO session of profile " + profile + " has expired, run aws sso login --profile " + profile)
+	log.Printf("the SSO session of profile %s has expired, logging in", profile)
+	args := []string{"sso", "login"}
+	if profile != "" {
+		args = append(args, "--profile", profile)
+	}
+	cmd := exec.CommandContext(ctx, "aws", args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// containerKeys would make SDKs use another credentials endpoint.
+var containerKeys = []string{
+	"AWS_CONTAINER_CREDENTIALS_FULL_URI",
+	"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+	"AWS_CONTAINER_AUTHORIZATION_TOKEN",
+	"AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE",
+}
+
+// credentialServer implements the container credentials endpoint of ECS for
+// the command, serving the latest session.
+type credentialServer struct {
+	token string
+
+	mu    sync.Mutex
+	creds *types.Credentials
+}
+
+func (s *credentialServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.serveHealth(w, r) {
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(s.token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	s.mu.Lock()
+	creds := s.creds
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		AccessKeyId     string
+		SecretAccessKey string
+		Token           string
+		Expiration      string
+	}{
+		AccessKeyId:     *creds.AccessKeyId,
+		SecretAccessKey: *creds.SecretAccessKey,
+		Token:           *creds.SessionToken,
+		Expiration:      creds.Expiration.Format(time.RFC3339),
+	})
+}
+
+// serveHealth answers /healthz while the server runs and /readyz while its
+// session does not expire within -cache-expiry-window, without authorization
+// since they reveal no credentials. It reports whether r was one of them.
+func (s *credentialServer) serveHealth(w http.ResponseWriter, r *http.Request) bool {
+	switch r.URL.Path {
+	case "/healthz":
+	case "/readyz":
+		s.mu.Lock()
+		expiration := *s.creds.Expiration
+		s.mu.Unlock()
+		if time.Until(expiration) <= cacheExpiryWindow {
+			http.Error(w, "the session expires at "+expiration.Format(time.RFC3339), http.StatusServiceUnavailable)
+			return true
+		}
+	default:
+		return false
+	}
+	fmt.Fprintln(w, "ok")
+	return true
+}
+
+// refreshLoop renews the session before it expires until ctx is done.
+func (s *credentialServer) refreshLoop(ctx context.Context, refresh func(context.Context) (*types.Credentials, error)) {
+	for {
+		s.mu.Lock()
+		expiration := *s.creds.Expiration
+		s.mu.Unlock()
+		wait := time.Until(expiration) - cacheExpiryWindow
+		if wait < 10*time.Second {
+			wait = 10 * time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		creds, err := refresh(ctx)
+		if err != nil {
+			log.Printf("cannot refresh the session, retrying: %v", err)
+			continue
+		}
+		s.mu.Lock()
+		s.creds = creds
+		s.mu.Unlock()
+	}
+}
+
+// startCredentialServer serves creds on a loopback port, renewing them with
+// refresh, and returns the environment pointing SDKs at it. The server is
+// closed by the cleanups.
+func startCredentialServer(ctx context.Context, creds *types.Credentials, refresh func(context.Context) (*types.Credentials, error)) ([]string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	s := &credentialServer{token: hex.EncodeToString(b), creds: creds}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	ctx, cancel := context.WithCancel(ctx)
+	atCleanup(func() {
+		cancel()
+		srv.Close()
+	})
+	go srv.Serve(ln)
+	go s.refreshLoop(ctx, refresh)
+	return []string{
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI=http://" + ln.Addr().String() + "/credentials",
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN=" + s.token,
+	}, nil
+}
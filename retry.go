@@ -0,0 +1,202 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+)
+
+type errorClass int
+
+const (
+	errorClassPermanent errorClass = iota
+	errorClassThrottling
+	errorClassServer
+	errorClassTransient
+)
+
+func (c errorClass) String() string {
+	switch c {
+	case errorClassThrottling:
+		return "throttling"
+	case errorClassServer:
+		return "server"
+	case errorClassTransient:
+		return "transient"
+	}
+	return "permanent"
+}
+
+var throttlingCodes = []string{
+	"Throttling",
+	"ThrottlingException",
+	"ThrottledException",
+	"RequestThrottled",
+	"RequestThrottledException",
+	"RequestLimitExceeded",
+	"TooManyRequestsException",
+	"PriorRequestNotComplete",
+	"SlowDown",
+}
+
+// classifyError decides if err is worth retrying. Authentication and
+// validation errors (AccessDenied, ExpiredToken, ValidationError, ...) are
+// permanent: retrying them only delays the failure.
+func classifyError(err error) errorClass {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		for _, c := range throttlingCodes {
+			if apiErr.ErrorCode() == c {
+				return errorClassThrottling
+			}
+		}
+	}
+	var respErr *awshttp.ResponseError
+	// without a response (status 0) the request did not reach the service
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() != 0 {
+		switch code := respErr.HTTPStatusCode(); {
+		case code == 429:
+			return errorClassThrottling
+		case code >= 500:
+			return errorClassServer
+		}
+		return errorClassPermanent
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return errorClassTransient
+	}
+	return errorClassPermanent
+}
+
+// retryBudget is the number of retries left for the whole process, so fan-out
+// over many calls cannot turn an outage into a retry storm.
+var retryBudget struct {
+	sync.Mutex
+	left int
+	init bool
+}
+
+func takeRetryBudget() bool {
+	retryBudget.Lock()
+	defer retryBudget.Unlock()
+	if !retryBudget.init {
+		retryBudget.left = retryBudgetSize
+		retryBudget.init = true
+	}
+	if retryBudget.left <= 0 {
+		return false
+	}
+	retryBudget.left--
+	return true
+}
+
+// adaptive is the sending rate of -retry-mode adaptive. Throttling halves the
+// rate of every call of the process, and each success raises it again until
+// it is unlimited (0).
+var adaptive struct {
+	sync.Mutex
+	rate float64 // calls per second
+	next time.Time
+}
+
+const (
+	adaptiveInitialRate = 10
+	adaptiveMinRate     = 0.5
+	adaptiveMaxRate     = 50
+)
+
+func adaptiveWait(ctx context.Context) error {
+	adaptive.Lock()
+	if adaptive.rate == 0 {
+		adaptive.Unlock()
+		return nil
+	}
+	now := time.Now()
+	if adaptive.next.Before(now) {
+		adaptive.next = now
+	}
+	wait := adaptive.next.Sub(now)
+	adaptive.next = adaptive.next.Add(time.Duration(float64(time.Second) / adaptive.rate))
+	adaptive.Unlock()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+func adaptiveUpdate(ok bool, class errorClass) {
+	if retryMode != "adaptive" {
+		return
+	}
+	adaptive.Lock()
+	defer adaptive.Unlock()
+	switch {
+	case !ok && class == errorClassThrottling:
+		if adaptive.rate == 0 {
+			adaptive.rate = adaptiveInitialRate
+		}
+		adaptive.rate = max(adaptive.rate/2, adaptiveMinRate)
+	case ok && adaptive.rate > 0:
+		if adaptive.rate++; adaptive.rate > adaptiveMaxRate {
+			adaptive.rate = 0
+		}
+	}
+}
+
+// backoff returns the delay before the attempt-th retry using exponential
+// backoff with full jitter. Throttling backs off from a larger base.
+func backoff(class errorClass, attempt int) time.Duration {
+	base := retryBaseDelay
+	if class == errorClassThrottling {
+		base *= 4
+	}
+	d := base << attempt
+	if d <= 0 || d > retryMaxDelay {
+		d = retryMaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// withRetry calls op until it succeeds, returns a permanent error, or runs out
+// of attempts or budget. SDK clients used with it should not retry by
+// themselves (see aws.NopRetryer).
+func withRetry(ctx context.Context, name string, op func(context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		if err := adaptiveWait(ctx); err != nil {
+			return err
+		}
+		start := time.Now()
+		err := op(ctx)
+		recordAttempt(name, attempt+1, start, err)
+		class := classifyError(err)
+		adaptiveUpdate(err == nil, class)
+		if err == nil {
+			return nil
+		}
+		if class == errorClassPermanent || attempt+1 >= retryMaxAttempts {
+			return err
+		}
+		if !takeRetryBudget() {
+			return fmt.Errorf("retry budget exhausted: %w", err)
+		}
+		d := backoff(class, attempt)
+		log.Printf("%s: retrying %s error in %s: %v", name, class, d, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(d):
+		}
+	}
+}
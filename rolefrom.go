@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudformation"
+)
+
+// resolveRoleFrom looks up the role ARN from infrastructure outputs:
+//
+//	cfn:STACK:OUTPUT      output of a CloudFormation stack (name or ARN)
+//	tf:DIR:OUTPUT         terraform output of the configuration in DIR
+//	tfstate:FILE:OUTPUT   output of a terraform state file
+func resolveRoleFrom(ctx context.Context, cfg aws.Config, ref string) (string, error) {
+	kind, rest, _ := strings.Cut(ref, ":")
+	i := strings.LastIndex(rest, ":")
+	if i < 0 {
+		return "", fmt.Errorf("invalid -role-from %q, must be KIND:SOURCE:OUTPUT", ref)
+	}
+	source, name := rest[:i], rest[i+1:]
+	var arn string
+	var err error
+	switch kind {
+	case "cfn":
+		arn, err = stackOutput(ctx, cfg, source, name)
+	case "tf":
+		arn, err = terraformOutput(ctx, source, name)
+	case "tfstate":
+		arn, err = terraformStateOutput(source, name)
+	default:
+		return "", fmt.Errorf("invalid -role-from %q, unknown kind %q (cfn, tf or tfstate)", ref, kind)
+	}
+	if err != nil {
+		return "", fmt.Errorf("-role-from %s: %w", ref, err)
+	}
+	if !strings.HasPrefix(arn, "arn:") {
+		return "", fmt.Errorf("-role-from %s: output is not an ARN: %q", ref, arn)
+	}
+	return arn, nil
+}
+
+func stackOutput(ctx context.Context, cfg aws.Config, stack, name string) (string, error) {
+	client := cloudformation.NewFromConfig(cfg, func(o *cloudformation.Options) {
+		o.Retryer = aws.NopRetryer{}
+	})
+	var out *cloudformation.DescribeStacksOutput
+	err := withRetry(ctx, "DescribeStacks", func(ctx context.Context) error {
+		var err error
+		out, err = client.DescribeStacks(ctx, &cloudformation.DescribeStacksInput{StackName: aws.String(stack)})
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, s := range out.Stacks {
+		for _, o := range s.Outputs {
+			if aws.ToString(o.OutputKey) == name {
+				return aws.ToString(o.OutputValue), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("stack %s has no output %s", stack, name)
+}
+
+func terraformOutput(ctx context.Context, dir, name string) (string, error) {
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, "terraform", "-chdir="+dir, "output", "-raw", name)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func terraformStateOutput(file, name string) (string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	var state struct {
+		Outputs map[string]struct {
+			Value any `json:"value"`
+		} `json:"outputs"`
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return "", fmt.Errorf("%s: %w", file, err)
+	}
+	o, ok := state.Outputs[name]
+	if !ok {
+		return "", fmt.Errorf("%s has no output %s", file, name)
+	}
+	v, ok := o.Value.(string)
+	if !ok {
+		return "", fmt.Errorf("output %s of %s is not a string", name, file)
+	}
+	return v, nil
+}
@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+)
+
+// parseTagFilter parses KEY=VALUE pairs separated by commas.
+func parseTagFilter(s string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, kv := range splitList(s) {
+		k, v, found := strings.Cut(kv, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid role tag %q, must be key=value", kv)
+		}
+		tags[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return tags, nil
+}
+
+// findRolesByTags returns the ARNs of the roles of the account whose IAM tags
+// include all of filter.
+func findRolesByTags(ctx context.Context, cfg aws.Config, filter map[string]string) ([]string, error) {
+	client := iam.NewFromConfig(cfg)
+	var arns []string
+	p := iam.NewListRolesPaginator(client, &iam.ListRolesInput{})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range out.Roles {
+			arns = append(arns, aws.ToString(r.Arn))
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		matches  []string
+		firstErr error
+	)
+	sem := make(chan struct{}, 8)
+	for _, arn := range arns {
+		arn := arn
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			out, err := client.ListRoleTags(ctx, &iam.ListRoleTagsInput{RoleName: aws.String(arn[strings.LastIndex(arn, "/")+1:])})
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			tags := map[string]string{}
+			for _, t := range out.Tags {
+				tags[aws.ToString(t.Key)] = aws.ToString(t.Value)
+			}
+			for k, v := range filter {
+				if tags[k] != v {
+					return
+				}
+			}
+			matches = append(matches, arn)
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	slices.Sort(matches)
+	return matches, nil
+}
+
+// resolveRoleTags returns the unique role matching the tags, or asks which of
+// the candidates to use.
+func resolveRoleTags(ctx context.Context, cfg aws.Config, s string) (string, error) {
+	filter, err := parseTagFilter(s)
+	if err != nil {
+		return "", err
+	}
+	arns, err := findRolesByTags(ctx, cfg, filter)
+	if err != nil {
+		return "", fmt.Errorf("-role-tags: %w", err)
+	}
+	switch len(arns) {
+	case 0:
+		return "", fmt.Errorf("-role-tags: no role is tagged with %s", s)
+	case 1:
+		return arns[0], nil
+	}
+	return choose(ctx, "roles tagged with "+s, arns)
+}
+
+// choose asks the user to pick one of candidates on the terminal, until ctx
+// is done.
+func choose(ctx context.Context, what string, candidates []string) (string, error) {
+	if ciMode || !isTerminal(os.Stdin) {
+		return "", fmt.Errorf("%d %s, narrow them down:\n  %s", len(candidates), what, strings.Join(candidates, "\n  "))
+	}
+	fmt.Fprintf(os.Stderr, "%d %s:\n", len(candidates), what)
+	for i, c := range candidates {
+		fmt.Fprintf(os.Stderr, "  %d) %s\n", i+1, c)
+	}
+	r := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Fprint(os.Stderr, "? ")
+		line, err := readLine(ctx, r)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if err != nil {
+			return "", fmt.Errorf("no %s chosen", what)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(line))
+		if err == nil && n >= 1 && n <= len(candidates) {
+			return candidates[n-1], nil
+		}
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ciProviders maps CI provider names used by rules to an environment variable
+// set by the provider.
+var ciProviders = [][2]string{
+	{"github-actions", "GITHUB_ACTIONS"},
+	{"gitlab", "GITLAB_CI"},
+	{"circleci", "CIRCLECI"},
+	{"buildkite", "BUILDKITE"},
+	{"jenkins", "JENKINS_URL"},
+	{"azure-pipelines", "TF_BUILD"},
+	{"bitbucket", "BITBUCKET_BUILD_NUMBER"},
+	{"codebuild", "CODEBUILD_BUILD_ID"},
+	{"travis", "TRAVIS"},
+}
+
+// roleRule selects Role when all of its conditions match. Patterns use the
+// syntax of path.Match.
+type roleRule struct {
+	Name        string
+	Role        string
+	CI          string
+	Env         [][2]string
+	Hostname    string
+	KubeContext string
+}
+
+// detectCI returns the name of the CI provider running the tool, "unknown"
+// for other CI systems setting CI, or an empty string.
+func detectCI() string {
+	for _, p := range ciProviders {
+		if os.Getenv(p[1]) != "" {
+			return p[0]
+		}
+	}
+	if os.Getenv("CI") != "" {
+		return "unknown"
+	}
+	return ""
+}
+
+// kubeContext returns the current context of the kubeconfig.
+func kubeContext() string {
+	b, err := os.ReadFile(kubeconfigFile())
+	if err != nil {
+		return ""
+	}
+	var kc struct {
+		CurrentContext string `yaml:"current-context"`
+	}
+	yaml.Unmarshal(b, &kc)
+	return kc.CurrentContext
+}
+
+func globMatch(pattern, s string) bool {
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
+
+func (r *roleRule) matches() bool {
+	switch ci := detectCI(); r.CI {
+	case "":
+	case "any":
+		if ci == "" {
+			return false
+		}
+	case "none":
+		if ci != "" {
+			return false
+		}
+	default:
+		if !globMatch(r.CI, ci) {
+			return false
+		}
+	}
+	for _, kv := range r.Env {
+		v, ok := os.LookupEnv(kv[0])
+		if !ok || !globMatch(kv[1], v) {
+			return false
+		}
+	}
+	if r.Hostname != "" {
+		h, _ := os.Hostname()
+		if !globMatch(r.Hostname, h) {
+			return false
+		}
+	}
+	if r.KubeContext != "" && !globMatch(r.KubeContext, kubeContext()) {
+		return false
+	}
+	return true
+}
+
+// loadRules reads the [rule NAME] sections of the tool config in file order.
+func loadRules() ([]*roleRule, string, error) {
+	name, err := toolConfigFile()
+	if err != nil {
+		return nil, "", err
+	}
+	sections, err := readINIFile(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, "", err
+	}
+	var rules []*roleRule
+	for _, s := range sections {
+		ruleName, ok := strings.CutPrefix(s.Name, "rule ")
+		if !ok {
+			continue
+		}
+		r := &roleRule{
+			Name:        ruleName,
+			Role:        s.get("role"),
+			CI:          s.get("ci"),
+			Hostname:    s.get("hostname"),
+			KubeContext: s.get("kube_context"),
+		}
+		for _, kv := range splitList(s.get("env")) {
+			k, v, found := strings.Cut(kv, "=")
+			if !found {
+				return nil, "", fmt.Errorf("%s: rule %s: invalid env %q, must be NAME=PATTERN", name, ruleName, kv)
+			}
+			r.Env = append(r.Env, [2]string{strings.TrimSpace(k), strings.TrimSpace(v)})
+		}
+		if r.Role == "" {
+			return nil, "", fmt.Errorf("%s: rule %s: role is required", name, ruleName)
+		}
+		rules = append(rules, r)
+	}
+	return rules, name, nil
+}
+
+// selectRole returns the role of the first matching rule and a description of
+// the rule, or an empty name when no rule matches.
+func selectRole() (string, string, error) {
+	rules, name, err := loadRules()
+	if err != nil {
+		return "", "", err
+	}
+	for _, r := range rules {
+		if r.matches() {
+			return r.Role, fmt.Sprintf("%s (rule %s)", name, r.Name), nil
+		}
+	}
+	return "", "", nil
+}
@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// scopePolicy generates a session policy allowing only the actions of the
+// [scope NAME] sections of the tool config called names.
+func scopePolicy(names []string) (string, error) {
+	file, err := toolConfigFile()
+	if err != nil {
+		return "", err
+	}
+	sections, err := readINIFile(file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	scopes := map[string]*iniSection{}
+	for _, s := range sections {
+		if name, ok := strings.CutPrefix(s.Name, "scope "); ok {
+			scopes[name] = s
+		}
+	}
+
+	type statement struct {
+		Effect   string
+		Action   []string
+		Resource []string
+	}
+	var statements []statement
+	for _, name := range names {
+		s, ok := scopes[name]
+		if !ok {
+			return "", fmt.Errorf("%s: scope %q is not defined", file, name)
+		}
+		actions := splitList(s.get("actions"))
+		for _, service := range splitList(s.get("services")) {
+			actions = append(actions, service+":*")
+		}
+		if len(actions) == 0 {
+			return "", fmt.Errorf("%s: scope %s: actions or services are required", file, name)
+		}
+		resources := splitList(s.get("resources"))
+		if len(resources) == 0 {
+			resources = []string{"*"}
+		}
+		statements = append(statements, statement{Effect: "Allow", Action: actions, Resource: resources})
+	}
+	b, err := json.Marshal(struct {
+		Version   string
+		Statement []statement
+	}{"2012-10-17", statements})
+	return string(b), err
+}
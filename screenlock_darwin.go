@@ -0,0 +1,16 @@
+// SPDX-License-Identifier: MIT
+//go:build darwin
+
+package main
+
+import (
+	"bytes"
+	"os/exec"
+)
+
+// screenLocked reports if the console session of the user is locked, from the
+// IOConsoleUsers of the I/O registry.
+func screenLocked() bool {
+	out, err := exec.Command("ioreg", "-n", "Root", "-d1").Output()
+	return err == nil && bytes.Contains(out, []byte(`"CGSSessionScreenIsLocked"=Yes`))
+}
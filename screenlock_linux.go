@@ -0,0 +1,21 @@
+// SPDX-License-Identifier: MIT
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+)
+
+// screenLocked reports the LockedHint of the logind session, which desktop
+// environments set while the screen is locked.
+func screenLocked() bool {
+	id := os.Getenv("XDG_SESSION_ID")
+	if id == "" {
+		id = "auto"
+	}
+	out, err := exec.Command("loginctl", "show-session", id, "-p", "LockedHint", "--value").Output()
+	return err == nil && bytes.Equal(bytes.TrimSpace(out), []byte("yes"))
+}
@@ -0,0 +1,9 @@
+// SPDX-License-Identifier: MIT
+//go:build !linux && !darwin
+
+package main
+
+// screenLocked is not known on other systems, where only sleep is noticed.
+func screenLocked() bool {
+	return false
+}
@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// sdkStoreFile is the AWS SDK Store of the .NET SDK and the AWS Toolkit for
+// Visual Studio, whose keys are encrypted with DPAPI for the current user.
+func sdkStoreFile() (string, error) {
+	dir := os.Getenv("LOCALAPPDATA")
+	if dir == "" {
+		return "", errors.New("LOCALAPPDATA is not set")
+	}
+	return filepath.Join(dir, "AWSToolkit", "RegisteredAccounts.json"), nil
+}
+
+// writeSDKStore saves creds as the profile called name, replacing a profile
+// with the same name.
+func writeSDKStore(name string, creds *types.Credentials) error {
+	p := map[string]any{
+		"DisplayName": name,
+		"ProfileType": "AWS",
+	}
+	for k, v := range map[string]string{
+		"AWSAccessKey": *creds.AccessKeyId,
+		"AWSSecretKey": *creds.SecretAccessKey,
+		"SessionToken": *creds.SessionToken,
+	} {
+		enc, err := protectData([]byte(v))
+		if err != nil {
+			return err
+		}
+		p[k] = hex.EncodeToString(enc)
+	}
+
+	file, err := sdkStoreFile()
+	if err != nil {
+		return err
+	}
+	profiles := map[string]map[string]any{}
+	b, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &profiles); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	id := ""
+	for k, p := range profiles {
+		if p["DisplayName"] == name {
+			id = k
+		}
+	}
+	if id == "" {
+		if id, err = newGUID(); err != nil {
+			return err
+		}
+	}
+	profiles[id] = p
+
+	b, err = json.MarshalIndent(profiles, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(file, b)
+}
+
+func newGUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b)
+	return strings.Join([]string{h[:8], h[8:12], h[12:16], h[16:20], h[20:]}, "-"), nil
+}
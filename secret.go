@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// secret holds sensitive bytes in memory that is locked against swapping when
+// the OS allows it, and which can be zeroed as soon as the value is no longer
+// needed. It never prints its contents through fmt.
+type secret struct {
+	b      []byte
+	locked bool
+}
+
+func newSecret(parts ...string) *secret {
+	n := 0
+	for _, p := range parts {
+		n += len(p)
+	}
+	s := &secret{b: make([]byte, 0, n)}
+	for _, p := range parts {
+		s.b = append(s.b, p...)
+	}
+	s.locked = len(s.b) > 0 && mlock(s.b) == nil
+	return s
+}
+
+// unsafeString returns the contents without copying, for APIs taking strings
+// like the environment of commands. wipe modifies the bytes, which Go assumes
+// never happens to a string: callers may only pass it to calls copying it,
+// like exec.Cmd.Start, and must drop every reference to it before wipe.
+func (s *secret) unsafeString() string {
+	if len(s.b) == 0 {
+		return ""
+	}
+	return unsafe.String(&s.b[0], len(s.b))
+}
+
+func (s *secret) wipe() {
+	clear(s.b)
+	if s.locked {
+		munlock(s.b)
+		s.locked = false
+	}
+}
+
+func (s *secret) String() string   { return "[REDACTED]" }
+func (s *secret) GoString() string { return "[REDACTED]" }
+
+func (s *secret) Format(f fmt.State, verb rune) {
+	fmt.Fprint(f, "[REDACTED]")
+}
+
+// credentialEnv returns the environment entries of creds backed by secrets.
+// The entries, and the commands holding them, must be dropped before the
+// returned wipe is called.
+func credentialEnv(creds *types.Credentials) ([]string, func()) {
+	secrets := []*secret{
+		newSecret("AWS_ACCESS_KEY_ID=", *creds.AccessKeyId),
+		newSecret("AWS_SECRET_ACCESS_KEY=", *creds.SecretAccessKey),
+		newSecret("AWS_SESSION_TOKEN=", *creds.SessionToken),
+	}
+	env := make([]string, 0, len(secrets))
+	for _, s := range secrets {
+		env = append(env, s.unsafeString())
+	}
+	return env, atCleanup(func() {
+		for _, s := range secrets {
+			s.wipe()
+		}
+	})
+}
@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+)
+
+// selectCandidate is a role offered by -select: an entry of the catalog, or a
+// role ARN found in IAM or Organizations.
+type selectCandidate struct {
+	label string // catalog name or account name
+	entry bool
+	arn   string
+}
+
+// pickRole sets the role picked by the user among the candidates of the
+// sources of -select-from.
+func pickRole(ctx context.Context) error {
+	candidates, err := selectCandidates(ctx)
+	if err != nil {
+		return fmt.Errorf("-select: %w", err)
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("-select: no role found in %s", selectFrom)
+	}
+	width := 0
+	for _, c := range candidates {
+		width = max(width, len(c.label))
+	}
+	lines := make([]string, len(candidates))
+	for i, c := range candidates {
+		lines[i] = strings.TrimSpace(fmt.Sprintf("%-*s  %s", width, c.label, c.arn))
+	}
+	line, err := pick(ctx, "roles", lines)
+	if err != nil {
+		return err
+	}
+	c := candidates[slices.Index(lines, line)]
+	if c.entry {
+		roleName = c.label
+	} else {
+		roleArn = c.arn
+	}
+	return nil
+}
+
+func selectCandidates(ctx context.Context) ([]selectCandidate, error) {
+	var (
+		candidates []selectCandidate
+		seen       = map[string]bool{}
+		cfg        *aws.Config
+	)
+	loadConfig := func() (aws.Config, error) {
+		if cfg != nil {
+			return *cfg, nil
+		}
+		endpointOpts, err := endpointOptions()
+		if err != nil {
+			return aws.Config{}, err
+		}
+		opts := append([]func(*config.LoadOptions) error{config.WithHTTPClient(sharedHTTPClient())}, endpointOpts...)
+		c, err := config.LoadDefaultConfig(ctx, append(opts, keyringOptions()...)...)
+		if err != nil {
+			return c, err
+		}
+		cfg = &c
+		return c, nil
+	}
+	add := func(c selectCandidate) {
+		if c.entry || !seen[c.arn] {
+			seen[c.arn] = true
+			candidates = append(candidates, c)
+		}
+	}
+	for _, source := range splitList(selectFrom) {
+		switch source {
+		case "config":
+			c, err := loadCatalog()
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range c.entries {
+				add(selectCandidate{label: e.Name, entry: true, arn: e.RoleArn})
+			}
+		case "iam":
+			cfg, err := loadConfig()
+			if err != nil {
+				return nil, err
+			}
+			arns, err := assumableRoles(ctx, cfg)
+			if err != nil {
+				return nil, fmt.Errorf("iam: %w", err)
+			}
+			for _, arn := range arns {
+				add(selectCandidate{arn: arn})
+			}
+		case "organizations":
+			cfg, err := loadConfig()
+			if err != nil {
+				return nil, err
+			}
+			p := organizations.NewListAccountsPaginator(organizations.NewFromConfig(cfg), &organizations.ListAccountsInput{})
+			for p.HasMorePages() {
+				out, err := p.NextPage(ctx)
+				if err != nil {
+					return nil, fmt.Errorf("organizations: %w", err)
+				}
+				for _, a := range out.Accounts {
+					add(selectCandidate{
+						label: aws.ToString(a.Name),
+						arn:   "arn:" + partition(cfg.Region) + ":iam::" + aws.ToString(a.Id) + ":role/" + selectRoleName,
+					})
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unknown source %q, must be config, iam or organizations", source)
+		}
+	}
+	return candidates, nil
+}
+
+// assumableRoles returns the ARNs of the roles of the account of the source
+// credentials whose trust policy allows them to be assumed by the caller.
+func assumableRoles(ctx context.Context, cfg aws.Config) ([]string, error) {
+	id, err := callerIdentity(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newCaller(*id.Arn)
+	if err != nil {
+		return nil, err
+	}
+	var arns []string
+	p := iam.NewListRolesPaginator(iam.NewFromConfig(cfg), &iam.ListRolesInput{})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range out.Roles {
+			statements, err := parseTrustPolicy(aws.ToString(r.AssumeRolePolicyDocument))
+			if err != nil {
+				continue
+			}
+			if ok, _ := evaluateTrustPolicy(statements, c, "sts:AssumeRole"); ok {
+				arns = append(arns, aws.ToString(r.Arn))
+			}
+		}
+	}
+	slices.Sort(arns)
+	return arns, nil
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// sessionTokenDurations are tried for -duration max with -session-token, from
+// the maximum for IAM users down to the maximum for the root user.
+var sessionTokenDurations = []time.Duration{36 * time.Hour, 12 * time.Hour, time.Hour}
+
+// callerIdentity returns the identity of the credentials of cfg.
+func callerIdentity(ctx context.Context, cfg aws.Config) (*sts.GetCallerIdentityOutput, error) {
+	client := sts.NewFromConfig(cfg, func(o *sts.Options) {
+		o.Retryer = aws.NopRetryer{}
+	})
+	var id *sts.GetCallerIdentityOutput
+	err := withRetry(ctx, "GetCallerIdentity", func(ctx context.Context) error {
+		var err error
+		id, err = client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		return err
+	})
+	return id, err
+}
+
+// getSessionToken returns a session of the IAM user of the source credentials
+// for d, with MFA when a serial number is configured. The session has the
+// identity of the user, which callerIdentity stored in roleArn.
+func getSessionToken(ctx context.Context, stsClient *sts.Client, d time.Duration, userID string) (*sts.AssumeRoleOutput, error) {
+	in := &sts.GetSessionTokenInput{
+		DurationSeconds: ptr(int32(d.Seconds())),
+		SerialNumber:    ptr(serialNumber),
+		TokenCode:       ptr(tokenCode),
+	}
+	var out *sts.GetSessionTokenOutput
+	err := withRetry(ctx, "GetSessionToken", func(ctx context.Context) error {
+		var err error
+		out, err = stsClient.GetSessionToken(ctx, in)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &sts.AssumeRoleOutput{
+		Credentials: out.Credentials,
+		AssumedRoleUser: &types.AssumedRoleUser{
+			Arn:           aws.String(roleArn),
+			AssumedRoleId: aws.String(userID),
+		},
+	}, nil
+}
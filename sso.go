@@ -0,0 +1,211 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/service/sso"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+	ssooidctypes "github.com/aws/aws-sdk-go-v2/service/ssooidc/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// ssoOnly reports if the IAM Identity Center role given with -sso-role-name
+// is the role itself, without a -role-arn to assume from it.
+func ssoOnly() bool {
+	return ssoStartURL != "" && len(roleArns) == 0 && roleName == "" && roleFrom == "" && roleTags == ""
+}
+
+// ssoToken is the legacy token cache format of the AWS CLI, so both tools
+// share the logins of a start URL.
+type ssoToken struct {
+	StartURL    string    `json:"startUrl"`
+	Region      string    `json:"region"`
+	AccessToken string    `json:"accessToken"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// ssoCredentials are the role credentials of -sso-account-id and
+// -sso-role-name, from the cached token of -sso-start-url.
+type ssoCredentials struct {
+	cfg aws.Config
+}
+
+func (p *ssoCredentials) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	token, err := cachedSSOToken()
+	if err != nil {
+		if token, err = ssoLogin(ctx, p.cfg); err != nil {
+			return aws.Credentials{}, err
+		}
+	}
+	out, err := sso.NewFromConfig(p.cfg, func(o *sso.Options) {
+		o.Region = ssoRegionOf(p.cfg)
+	}).GetRoleCredentials(ctx, &sso.GetRoleCredentialsInput{
+		AccessToken: aws.String(token),
+		AccountId:   aws.String(ssoAccountID),
+		RoleName:    aws.String(ssoRoleName),
+	})
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	c := out.RoleCredentials
+	return aws.Credentials{
+		AccessKeyID:     *c.AccessKeyId,
+		SecretAccessKey: *c.SecretAccessKey,
+		SessionToken:    *c.SessionToken,
+		Source:          "SSO",
+		CanExpire:       true,
+		Expires:         time.UnixMilli(c.Expiration),
+	}, nil
+}
+
+func ssoRegionOf(cfg aws.Config) string {
+	if ssoRegion != "" {
+		return ssoRegion
+	}
+	return cfg.Region
+}
+
+// cachedSSOToken returns the access token of the start URL when it is valid
+// for at least another minute.
+func cachedSSOToken() (string, error) {
+	name, err := ssocreds.StandardCachedTokenFilepath(ssoStartURL)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	var t ssoToken
+	if err := json.Unmarshal(b, &t); err != nil {
+		return "", err
+	}
+	if t.AccessToken == "" || time.Until(t.ExpiresAt) < time.Minute {
+		return "", errors.New("the SSO token has expired")
+	}
+	return t.AccessToken, nil
+}
+
+// ssoLogin runs the device authorization flow of the start URL: the user
+// approves the request in the browser while the tool polls for the token,
+// which is then cached.
+func ssoLogin(ctx context.Context, cfg aws.Config) (string, error) {
+	requireInteraction("logging in to " + ssoStartURL)
+	region := ssoRegionOf(cfg)
+	if region == "" {
+		return "", errors.New("-sso-region is required")
+	}
+	client := ssooidc.NewFromConfig(cfg, func(o *ssooidc.Options) {
+		o.Region = region
+	})
+	reg, err := client.RegisterClient(ctx, &ssooidc.RegisterClientInput{
+		ClientName: aws.String("aws-assume-role"),
+		ClientType: aws.String("public"),
+	})
+	if err != nil {
+		return "", err
+	}
+	auth, err := client.StartDeviceAuthorization(ctx, &ssooidc.StartDeviceAuthorizationInput{
+		ClientId:     reg.ClientId,
+		ClientSecret: reg.ClientSecret,
+		StartUrl:     aws.String(ssoStartURL),
+	})
+	if err != nil {
+		return "", err
+	}
+	log.Printf("approve the login in the browser with code %s: %s", *auth.UserCode, *auth.VerificationUriComplete)
+	if err := openBrowser(*auth.VerificationUriComplete); err != nil {
+		log.Printf("cannot open the browser: %v", err)
+	}
+
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second)
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(interval):
+		}
+		out, err := client.CreateToken(ctx, &ssooidc.CreateTokenInput{
+			ClientId:     reg.ClientId,
+			ClientSecret: reg.ClientSecret,
+			GrantType:    aws.String("urn:ietf:params:oauth:grant-type:device_code"),
+			DeviceCode:   auth.DeviceCode,
+		})
+		var pending *ssooidctypes.AuthorizationPendingException
+		var slowDown *ssooidctypes.SlowDownException
+		switch {
+		case errors.As(err, &pending):
+		case errors.As(err, &slowDown):
+			interval += 5 * time.Second
+		case err != nil:
+			return "", err
+		default:
+			t := ssoToken{
+				StartURL:    ssoStartURL,
+				Region:      region,
+				AccessToken: *out.AccessToken,
+				ExpiresAt:   time.Now().Add(time.Duration(out.ExpiresIn) * time.Second).UTC(),
+			}
+			if err := storeSSOToken(t); err != nil {
+				log.Printf("cannot cache the SSO token: %v", err)
+			}
+			return t.AccessToken, nil
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("the login to %s was not approved in time", ssoStartURL)
+		}
+	}
+}
+
+func storeSSOToken(t ssoToken) error {
+	name, err := ssocreds.StandardCachedTokenFilepath(ssoStartURL)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(name, b)
+}
+
+// ssoRoleSession returns the credentials of the IAM Identity Center role as
+// the session, with the identity of the role for the environment and the
+// summary.
+func ssoRoleSession(ctx context.Context, cfg aws.Config) (*sts.AssumeRoleOutput, error) {
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id, err := callerIdentity(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	roleArn = *id.Arn
+	return &sts.AssumeRoleOutput{
+		Credentials: &types.Credentials{
+			AccessKeyId:     aws.String(creds.AccessKeyID),
+			SecretAccessKey: aws.String(creds.SecretAccessKey),
+			SessionToken:    aws.String(creds.SessionToken),
+			Expiration:      aws.Time(creds.Expires),
+		},
+		AssumedRoleUser: &types.AssumedRoleUser{
+			Arn:           id.Arn,
+			AssumedRoleId: id.UserId,
+		},
+	}, nil
+}
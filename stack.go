@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// stackKey and depthKey describe the roles of the nested shells started by
+// this tool, outermost first, so prompts can show e.g. dev→prod-admin.
+const (
+	stackKey = "AWS_ASSUME_ROLE_STACK"
+	depthKey = "AWS_ASSUME_ROLE_DEPTH"
+)
+
+type stackEntry struct {
+	Name string `json:"name"`
+	Arn  string `json:"arn"`
+}
+
+func readStack() []stackEntry {
+	var stack []stackEntry
+	if v := os.Getenv(stackKey); v != "" {
+		json.Unmarshal([]byte(v), &stack)
+	}
+	return stack
+}
+
+func stackEnv(stack []stackEntry) []string {
+	b, _ := json.Marshal(stack)
+	return []string{
+		stackKey + "=" + string(b),
+		depthKey + "=" + strconv.Itoa(len(stack)),
+	}
+}
+
+// roleLabel is the name of the assumed role shown in the stack.
+func roleLabel() string {
+	if roleName != "" {
+		return roleName
+	}
+	return roleArn[strings.LastIndex(roleArn, "/")+1:]
+}
+
+func runPrompt(args []string) error {
+	flags := flag.NewFlagSet("prompt", flag.ExitOnError)
+	sep := flags.String("sep", "→", "separator between the roles")
+	flags.Usage = func() {
+		fmt.Fprintf(
+			flags.Output(),
+			"Usage: %s prompt [-sep SEP]\n\n"+
+				"Prints the roles of the nested shells, e.g. for PS1='$(aws-assume-role prompt) $ '\n\n",
+			os.Args[0],
+		)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	stack := readStack()
+	if len(stack) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(stack))
+	for _, e := range stack {
+		names = append(names, e.Name)
+	}
+	fmt.Println(strings.Join(names, *sep))
+	return nil
+}
+
+// runPop explains which credentials apply after exiting the current shell.
+func runPop(args []string) error {
+	stack := readStack()
+	switch len(stack) {
+	case 0:
+		fmt.Println("this shell has no credentials issued by aws-assume-role")
+	case 1:
+		fmt.Printf("this shell uses %s (%s), exiting it returns to the credentials outside aws-assume-role\n", stack[0].Name, stack[0].Arn)
+	default:
+		cur, prev := stack[len(stack)-1], stack[len(stack)-2]
+		fmt.Printf("this shell uses %s (%s), exiting it returns to %s (%s)\n", cur.Name, cur.Arn, prev.Name, prev.Arn)
+	}
+	return nil
+}
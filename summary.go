@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// startTime is the start of the process for the wall time of the summary.
+var startTime = time.Now()
+
+// runSummary is written to -summary-fd or -summary-file after the command
+// exits.
+type runSummary struct {
+	RoleArn         string  `json:"role_arn"`
+	AssumedRoleArn  string  `json:"assumed_role_arn"`
+	Account         string  `json:"account"`
+	RoleSessionName string  `json:"role_session_name"`
+	AssumeSeconds   float64 `json:"assume_seconds"`
+	Expiration      string  `json:"expiration"`
+	ExitCode        int     `json:"exit_code"`
+	WallSeconds     float64 `json:"wall_seconds"`
+}
+
+func newRunSummary(role *sts.AssumeRoleOutput, latency time.Duration) *runSummary {
+	account, _ := accountIDFromArn(*role.AssumedRoleUser.Arn)
+	return &runSummary{
+		RoleArn:         roleArn,
+		AssumedRoleArn:  *role.AssumedRoleUser.Arn,
+		Account:         account,
+		RoleSessionName: roleSessionName,
+		AssumeSeconds:   latency.Seconds(),
+		Expiration:      role.Credentials.Expiration.Format(time.RFC3339),
+	}
+}
+
+// writeSummary writes s with the exit code of the command, when requested.
+func writeSummary(s *runSummary, exitCode int) error {
+	if summaryFD <= 0 && summaryFile == "" {
+		return nil
+	}
+	s.ExitCode = exitCode
+	s.WallSeconds = time.Since(startTime).Seconds()
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if summaryFile != "" {
+		return writeFileAtomic(summaryFile, b)
+	}
+	f := os.NewFile(uintptr(summaryFD), "summary")
+	defer f.Close()
+	_, err = f.Write(b)
+	return err
+}
@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// tagValue is a flag.Value appending key=value session tags.
+type tagValue []types.Tag
+
+func (v *tagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	var s []string
+	for _, t := range *v {
+		s = append(s, *t.Key+"="+*t.Value)
+	}
+	return strings.Join(s, ",")
+}
+
+func (v *tagValue) Set(s string) error {
+	k, val, found := strings.Cut(s, "=")
+	if !found || strings.TrimSpace(k) == "" {
+		return fmt.Errorf("invalid tag %q, must be key=value", s)
+	}
+	*v = append(*v, types.Tag{Key: aws.String(strings.TrimSpace(k)), Value: aws.String(strings.TrimSpace(val))})
+	return nil
+}
+
+// mergeTags returns the tags of base overridden by the ones of override with
+// the same key, which are case-insensitive like in STS.
+func mergeTags(base, override []types.Tag) []types.Tag {
+	tags := slices.Clone(override)
+	for _, t := range base {
+		if !hasTag(override, *t.Key) {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
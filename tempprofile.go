@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// profileKeys select another profile or config file than the temporary one.
+var profileKeys = []string{
+	"AWS_PROFILE",
+	"AWS_DEFAULT_PROFILE",
+	"AWS_CONFIG_FILE",
+	"AWS_SHARED_CREDENTIALS_FILE",
+}
+
+// writeTempProfile writes a config and credentials file pair with the profile
+// called name into a private temporary directory, which is removed by the
+// cleanups, and returns the environment selecting it.
+func writeTempProfile(name, region string, creds *types.Credentials) ([]string, error) {
+	dir, err := os.MkdirTemp("", "aws-assume-role-")
+	if err != nil {
+		return nil, err
+	}
+	atCleanup(func() { os.RemoveAll(dir) })
+	if err := mkdirPrivate(dir); err != nil {
+		return nil, err
+	}
+
+	var config strings.Builder
+	fmt.Fprintf(&config, "[profile %s]\n", name)
+	if region != "" {
+		fmt.Fprintf(&config, "region = %s\n", region)
+	}
+	configFile := filepath.Join(dir, "config")
+	if err := writeFileAtomic(configFile, []byte(config.String())); err != nil {
+		return nil, err
+	}
+	credentialsFile := filepath.Join(dir, "credentials")
+	s := newSecret(
+		"[", name, "]\n",
+		"aws_access_key_id = ", *creds.AccessKeyId, "\n",
+		"aws_secret_access_key = ", *creds.SecretAccessKey, "\n",
+		"aws_session_token = ", *creds.SessionToken, "\n",
+	)
+	defer s.wipe()
+	if err := writeFileAtomic(credentialsFile, s.b); err != nil {
+		return nil, err
+	}
+	return []string{
+		"AWS_PROFILE=" + name,
+		"AWS_CONFIG_FILE=" + configFile,
+		"AWS_SHARED_CREDENTIALS_FILE=" + credentialsFile,
+	}, nil
+}
@@ -0,0 +1,28 @@
+// SPDX-License-Identifier: MIT
+//go:build !linux && !darwin && !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+func startTTY(cmd *exec.Cmd) (wait func() error, err error) {
+	return nil, fmt.Errorf("-tty is not supported on %s", runtime.GOOS)
+}
+
+func termWidth(f *os.File) int {
+	return 0
+}
+
+func makeRaw(f *os.File) (restore func(), err error) {
+	return nil, errors.ErrUnsupported
+}
+
+func disableEcho(f *os.File) (restore func(), err error) {
+	return nil, errors.ErrUnsupported
+}
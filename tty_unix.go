@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: MIT
+//go:build linux || darwin
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+type winsize struct {
+	Row, Col, Xpixel, Ypixel uint16
+}
+
+func ioctl(fd, req, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// startTTY starts cmd on a new pseudo-terminal proxied to the terminal of the
+// wrapper: the terminal is put into raw mode so every key reaches the command
+// unchanged, input and output are copied, and window size changes are
+// forwarded. The returned wait replaces cmd.Wait and also waits for the
+// output of the command to be copied.
+func startTTY(cmd *exec.Cmd) (wait func() error, err error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+	// the command holds its own copy, the master reads EOF once it exits
+	defer slave.Close()
+
+	restore, err := makeRaw(os.Stdin)
+	switch {
+	case err == nil:
+		restore = atCleanup(restore)
+		resizeTTY(master)
+	case errors.Is(err, syscall.ENOTTY):
+		// the input is not a terminal, there is nothing to proxy but data
+		restore = func() {}
+	default:
+		master.Close()
+		return nil, err
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	// the command leads a new session controlled by the pseudo-terminal, so it
+	// gets job control and SIGWINCH like under a terminal emulator
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := cmd.Start(); err != nil {
+		restore()
+		master.Close()
+		return nil, err
+	}
+
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		for range winch {
+			resizeTTY(master)
+		}
+	}()
+	go io.Copy(master, os.Stdin)
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(os.Stdout, master)
+		close(copied)
+	}()
+	return func() error {
+		err := cmd.Wait()
+		signal.Stop(winch)
+		// background jobs of the command may keep the terminal open
+		select {
+		case <-copied:
+		case <-time.After(time.Second):
+		}
+		restore()
+		return err
+	}, nil
+}
+
+// resizeTTY copies the window size of the terminal of the wrapper to the
+// pseudo-terminal, which signals SIGWINCH to the command.
+func resizeTTY(master *os.File) {
+	var ws winsize
+	if ioctl(os.Stdin.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws))) == nil {
+		ioctl(master.Fd(), syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws)))
+	}
+}
+
+// termWidth returns the number of columns of the terminal f, or 0 when it is
+// unknown.
+func termWidth(f *os.File) int {
+	var ws winsize
+	if ioctl(f.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws))) != nil {
+		return 0
+	}
+	return int(ws.Col)
+}
+
+// makeRaw disables line editing, echo and signal keys of the terminal f like
+// cfmakeraw(3), and returns a function restoring its previous state.
+func makeRaw(f *os.File) (restore func(), err error) {
+	var old syscall.Termios
+	if err := ioctl(f.Fd(), ioctlGetTermios, uintptr(unsafe.Pointer(&old))); err != nil {
+		return nil, err
+	}
+	raw := old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(f.Fd(), ioctlSetTermios, uintptr(unsafe.Pointer(&raw))); err != nil {
+		return nil, err
+	}
+	return func() {
+		ioctl(f.Fd(), ioctlSetTermios, uintptr(unsafe.Pointer(&old)))
+	}, nil
+}
+
+// disableEcho stops the terminal f from echoing the input, and returns a
+// function restoring it.
+func disableEcho(f *os.File) (restore func(), err error) {
+	var old syscall.Termios
+	if err := ioctl(f.Fd(), ioctlGetTermios, uintptr(unsafe.Pointer(&old))); err != nil {
+		return nil, err
+	}
+	noEcho := old
+	noEcho.Lflag &^= syscall.ECHO
+	if err := ioctl(f.Fd(), ioctlSetTermios, uintptr(unsafe.Pointer(&noEcho))); err != nil {
+		return nil, err
+	}
+	return func() {
+		ioctl(f.Fd(), ioctlSetTermios, uintptr(unsafe.Pointer(&old)))
+	}, nil
+}
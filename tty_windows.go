@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: MIT
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+var procSetConsoleMode = modkernel32.NewProc("SetConsoleMode")
+
+const enableEchoInput = 0x4
+
+// startTTY is not supported: console programs already talk to the console of
+// the wrapper directly.
+func startTTY(cmd *exec.Cmd) (wait func() error, err error) {
+	return nil, errors.New("-tty is not supported on windows")
+}
+
+func termWidth(f *os.File) int {
+	return 0
+}
+
+func makeRaw(f *os.File) (restore func(), err error) {
+	return nil, errors.ErrUnsupported
+}
+
+// disableEcho clears ENABLE_ECHO_INPUT of the console input f, and returns a
+// function restoring it.
+func disableEcho(f *os.File) (restore func(), err error) {
+	h := syscall.Handle(f.Fd())
+	var mode uint32
+	if err := syscall.GetConsoleMode(h, &mode); err != nil {
+		return nil, err
+	}
+	if r, _, err := procSetConsoleMode.Call(uintptr(h), uintptr(mode&^enableEchoInput)); r == 0 {
+		return nil, err
+	}
+	return func() {
+		procSetConsoleMode.Call(uintptr(h), uintptr(mode))
+	}, nil
+}
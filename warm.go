@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// catalogFlags are the flags set by applyCatalogEntry and resolveRole, which
+// are restored before each role of warm and serve.
+type catalogFlags struct {
+	roleArn              string
+	roleSessionName      string
+	generatedSessionName bool
+	duration             time.Duration
+	externalID           string
+	serialNumber         string
+	transitiveTagKeys    []string
+	policyArns           []string
+	policy               string
+	requireMFA           bool
+	deriveIdentity       bool
+	identityTags         string
+	sessionTags          []types.Tag
+}
+
+func currentCatalogFlags() catalogFlags {
+	return catalogFlags{roleArn, roleSessionName, generatedSessionName, duration, externalID, serialNumber, transitiveTagKeys, policyArns, policy, requireMFA, deriveIdentity, identityTags, sessionTags}
+}
+
+func (f catalogFlags) restore() {
+	roleArn, roleSessionName, generatedSessionName = f.roleArn, f.roleSessionName, f.generatedSessionName
+	duration, externalID, serialNumber = f.duration, f.externalID, f.serialNumber
+	transitiveTagKeys, policyArns, policy = f.transitiveTagKeys, f.policyArns, f.policy
+	requireMFA, deriveIdentity, identityTags = f.requireMFA, f.deriveIdentity, f.identityTags
+	sessionTags = f.sessionTags
+}
+
+// runWarm assumes the roles of the catalog, or of the given names, into the
+// session cache, so later invocations use the cached sessions without calling
+// STS or asking for MFA. The code is asked once per source profile and MFA
+// device, whose roles are assumed from an MFA session like with -fanout. The
+// roles are assumed one after the other since the flags hold the role being
+// assumed.
+func runWarm(args []string) error {
+	flag.CommandLine.Parse(args)
+	if noCache {
+		return errors.New("warm fills the session cache, it cannot be used with -no-cache")
+	}
+	c, err := loadCatalog()
+	if err != nil {
+		return err
+	}
+	names := flag.Args()
+	for _, name := range names {
+		if _, ok := c.lookup(name); !ok {
+			return fmt.Errorf("role %q is not found in the catalog", name)
+		}
+	}
+	if len(names) == 0 {
+		for _, e := range c.entries {
+			names = append(names, e.Name)
+		}
+	}
+	if len(names) == 0 {
+		return errors.New("the catalog has no roles")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	helperMode = true
+	flags := currentCatalogFlags()
+	sessions := map[[2]string]aws.CredentialsProvider{}
+	var failed int
+	for _, name := range names {
+		flags.restore()
+		roleName = name
+		loadOpts := resolveRole(ctx)
+		mfaSession = nil
+		if serialNumber != "" {
+			e, _ := c.lookup(name)
+			key := [2]string{e.SourceProfile, serialNumber}
+			if sessions[key] == nil {
+				if sessions[key], err = mfaSessionProvider(ctx, loadOpts); err != nil {
+					return err
+				}
+			}
+			mfaSession = sessions[key]
+		}
+		role, _, err := assumeRole(ctx, loadOpts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			failed++
+			log.Printf("%s: %v", name, err)
+			continue
+		}
+		log.Printf("%s: cached until %s", name, role.Credentials.Expiration.Local().Format(time.RFC3339))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d roles could not be assumed", failed, len(names))
+	}
+	return nil
+}
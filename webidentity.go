@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"strings"
+)
+
+// webIdentityToken reads the OIDC token of -web-identity-token-file, which is
+// read again for every call since CI systems rotate it.
+func webIdentityToken() (string, error) {
+	b, err := os.ReadFile(webIdentityTokenFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// webIdentitySource identifies the token in the cache key instead of the
+// unused source credentials.
+func webIdentitySource() (string, error) {
+	token, err := webIdentityToken()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "web-identity:" + hex.EncodeToString(sum[:]), nil
+}
+
+func warnWebIdentityIgnored() {
+	if len(sessionTags) > 0 || sourceIdentity != "" || externalID != "" {
+		log.Print("session tags, the source identity and the external ID are not used with -web-identity-token-file, they come from the token or do not apply")
+	}
+}
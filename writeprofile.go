@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// awsCredentialsFile returns the shared credentials file of the AWS CLI and
+// SDKs.
+func awsCredentialsFile() (string, error) {
+	if v := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); v != "" {
+		return v, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".aws", "credentials"), nil
+}
+
+// writeCredentialsProfile sets the credentials of the profile in the shared
+// credentials file name, or the default one, preserving the other profiles
+// and comments. Profiles holding long-term access keys are not overwritten.
+func writeCredentialsProfile(name, profile string, creds *types.Credentials) (string, error) {
+	if name == "" {
+		var err error
+		if name, err = awsCredentialsFile(); err != nil {
+			return "", err
+		}
+	}
+	b, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	sections, err := parseINI(strings.NewReader(string(b)))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	for _, s := range sections {
+		if s.Name == profile && s.get("aws_access_key_id") != "" && s.get("aws_session_token") == "" {
+			return "", fmt.Errorf("%s: [%s] holds long-term access keys, write to another profile", name, profile)
+		}
+	}
+	content := updateINISection(string(b), profile, []string{"# written by aws-assume-role"}, [][2]string{
+		{"aws_access_key_id", *creds.AccessKeyId},
+		{"aws_secret_access_key", *creds.SecretAccessKey},
+		{"aws_session_token", *creds.SessionToken},
+		// ignored by the SDKs, for the user
+		{"expiration", creds.Expiration.UTC().Format(time.RFC3339)},
+	})
+	return name, writeFileAtomic(name, []byte(content))
+}
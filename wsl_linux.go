@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: MIT
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// wslForwardedKeys are forwarded to Windows executables started from WSL. Keys
+// with the /p flag hold paths that WSL translates to Windows paths.
+var wslForwardedKeys = []string{
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_REGION",
+	"AWS_DEFAULT_REGION",
+	"AWS_PROFILE",
+	"AWS_CONFIG_FILE/p",
+	"AWS_SHARED_CREDENTIALS_FILE/p",
+	"AWS_CA_BUNDLE/p",
+}
+
+func isWSL() bool {
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	_, err := os.Stat("/proc/sys/fs/binfmt_misc/WSLInterop")
+	return err == nil
+}
+
+// isWindowsExecutable reports whether name resolves to a PE executable, which
+// WSL runs on the Windows side.
+func isWindowsExecutable(name string) bool {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return false
+	}
+	if strings.HasSuffix(strings.ToLower(path), ".exe") {
+		return true
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false
+	}
+	return string(magic) == "MZ"
+}
+
+// wslEnv adds the AWS variables of env to WSLENV when the command is a Windows
+// executable, since WSL only shares the variables listed there across the
+// boundary.
+func wslEnv(args, env []string) []string {
+	if !isWSL() || !isWindowsExecutable(args[0]) {
+		return env
+	}
+
+	present := map[string]bool{}
+	var wslenv []string
+	idx := -1
+	for i, e := range env {
+		k, v, _ := strings.Cut(e, "=")
+		present[k] = true
+		if k == "WSLENV" {
+			idx = i
+			if v != "" {
+				wslenv = strings.Split(v, ":")
+			}
+		}
+	}
+	for _, k := range wslForwardedKeys {
+		name, _, _ := strings.Cut(k, "/")
+		if !present[name] || slices.ContainsFunc(wslenv, func(e string) bool {
+			n, _, _ := strings.Cut(e, "/")
+			return n == name
+		}) {
+			continue
+		}
+		wslenv = append(wslenv, k)
+	}
+
+	entry := "WSLENV=" + strings.Join(wslenv, ":")
+	if idx < 0 {
+		return append(env, entry)
+	}
+	env[idx] = entry
+	return env
+}
@@ -0,0 +1,12 @@
+// SPDX-License-Identifier: MIT
+//go:build !linux
+
+package main
+
+func wslEnv(args, env []string) []string {
+	return env
+}
+
+func isWSL() bool {
+	return false
+}